@@ -1,24 +1,88 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/antonfollinger/kademlia_go/internal/kademlia"
 )
 
 func main() {
+	exportPath := flag.String("export", "", "write every value stored in STORAGEDIR to this file as JSON Lines and exit, without starting the node")
+	importPath := flag.String("import", "", "load the values in this JSON Lines export on startup")
+	republish := flag.Bool("republish", false, "with -import, also store the imported values in the network")
+	flag.Parse()
+
 	isBootstrap := os.Getenv("ISBOOTSTRAP")
 	port := os.Getenv("PORT")
+	storageDir := os.Getenv("STORAGEDIR")
+	keySpaceName := os.Getenv("KEYSPACE")
+
+	// An export only reads the value store, so it is written without starting the node.
+	// The store is opened read-only, since a running node may still be writing to it
+	if *exportPath != "" {
+		if storageDir == "" {
+			fmt.Fprintln(os.Stderr, "-export needs STORAGEDIR, a node without it keeps its values in memory only")
+			os.Exit(1)
+		}
+		storage, err := kademlia.OpenDiskStorageReadOnly(storageDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open storage in %s: %v\n", storageDir, err)
+			os.Exit(1)
+		}
+		result, err := kademlia.ExportStorageFile(storage, *exportPath)
+		storage.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export %s: %v\n", *exportPath, err)
+			os.Exit(1)
+		}
+		fmt.Print(result)
+		return
+	}
 
 	var k *kademlia.Kademlia
 	var kadErr error
 	var bootstrapIP string
+	var opts []kademlia.KademliaOption
+
+	// Keep values on disk so they survive restarts, otherwise in memory
+	if storageDir != "" {
+		storage, err := kademlia.NewDiskStorage(storageDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open storage in %s: %v\n", storageDir, err)
+			os.Exit(1)
+		}
+		defer storage.Close()
+		opts = append(opts, kademlia.WithStorage(storage))
+		// The routing table is kept next to the values so a restarted node can rejoin without the bootstrap node
+		opts = append(opts, kademlia.WithRoutingTablePath(filepath.Join(storageDir, "routingtable.json")))
+		// The same publisher key lets the node delete the values it published before a restart
+		publisherKey, err := kademlia.LoadPublisherKey(filepath.Join(storageDir, "publisher.key"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load publisher key: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, kademlia.WithPublisherKey(publisherKey))
+	}
+
+	// Every node of a network must use the same key space
+	if keySpaceName != "" {
+		keySpace, err := kademlia.KeySpaceByName(keySpaceName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid KEYSPACE: %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, kademlia.WithKeySpace(keySpace))
+	}
 
 	if isBootstrap == "TRUE" {
-		k, kadErr = kademlia.InitKademlia(port, true, "")
+		k, kadErr = kademlia.InitKademlia(port, true, "", opts...)
 		if kadErr != nil {
 			fmt.Fprintf(os.Stderr, "Failed to initialize Kademlia: %v\n", kadErr)
 			os.Exit(1)
@@ -44,12 +108,34 @@ func main() {
 
 		bootstrapIP = bootStrapAddr[0].String() + ":" + "9001"
 
-		k, kadErr = kademlia.InitKademlia(port, false, bootstrapIP)
+		k, kadErr = kademlia.InitKademlia(port, false, bootstrapIP, opts...)
 		if kadErr != nil {
 			fmt.Fprintf(os.Stderr, "Failed to initialize Kademlia: %v\n", kadErr)
 			os.Exit(1)
 		}
 	}
 
+	if *importPath != "" {
+		result, err := k.Node.ImportFile(*importPath, *republish)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import %s: %v\n", *importPath, err)
+			os.Exit(1)
+		}
+		fmt.Print(result)
+	}
+
+	// Save the routing table when the node is stopped from outside, e.g. by docker stop,
+	// so it can rejoin after the restart like after exit
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		<-signals
+		k.Node.Stop()
+		if err := k.Node.SaveRoutingTable(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save routing table: %v\n", err)
+		}
+		os.Exit(0)
+	}()
+
 	k.Node.Cli(os.Stdin, os.Stdout)
 }
@@ -0,0 +1,95 @@
+package kademlia
+
+import (
+	"log"
+	"time"
+)
+
+// UnderReplicatedKey is a value that not all of the k closest nodes hold, even after repair.
+// In a network of fewer than k nodes every node found counts as one of the closest
+type UnderReplicatedKey struct {
+	Key      string
+	Replicas int
+}
+
+// ReplicaStats summarises the most recent replica audit
+type ReplicaStats struct {
+	LastAudit       time.Time
+	Audited         int // values checked
+	Repaired        int // replicas re-stored to nodes that had lost them
+	UnderReplicated []UnderReplicatedKey
+}
+
+// AuditReplicas checks, for every value this node holds, which of the k closest nodes still
+// hold it and re-stores it to those that do not. Cached copies, erasure shards, which are kept at
+// ShardReplicas nodes only, and expired values are skipped
+func (node *Node) AuditReplicas() ReplicaStats {
+	now := time.Now()
+	stats := ReplicaStats{LastAudit: now}
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if record.Cached || record.Shard || record.Expired(now) {
+			return true
+		}
+		replicas, wanted, repaired := node.auditKey(key, record, now)
+		stats.Audited++
+		stats.Repaired += repaired
+		if replicas < wanted {
+			stats.UnderReplicated = append(stats.UnderReplicated, UnderReplicatedKey{Key: key, Replicas: replicas})
+		}
+		return true
+	})
+
+	node.auditMu.Lock()
+	node.replicaStats = stats
+	node.auditMu.Unlock()
+	return stats
+}
+
+// auditKey returns how many of the closest nodes hold the value after repair, counting this
+// node when it is one of them, how many of them should hold it, at most K, and how many replicas
+// had to be re-stored
+func (node *Node) auditKey(key string, record Record, now time.Time) (replicas int, wanted int, repaired int) {
+	keyID, err := node.config.KeySpace.Parse(key)
+	if err != nil {
+		return 0, 0, 0
+	}
+	closest, err := node.IterativeFindNode(keyID)
+	if err != nil {
+		log.Printf("audit of %s failed: %v\n", key, err)
+		return 0, 0, 0
+	}
+
+	ttl := node.config.ValueTTL
+	if !record.ExpiresAt.IsZero() {
+		ttl = record.ExpiresAt.Sub(now)
+	}
+	for _, contact := range closest {
+		if contact.ID == nil {
+			continue
+		}
+		wanted++
+		if contact.ID.Equals(node.Id) {
+			replicas++
+			continue
+		}
+		resp, err := node.Client.SendFindValueAtMessage(key, contact)
+		if err == nil && resp.Payload.hasValue() && resp.Payload.Seq >= record.Seq {
+			replicas++
+			continue
+		}
+		if err := node.Client.SendStoreAtMessage(key, record, ttl, contact); err != nil {
+			log.Printf("failed to repair %s at %s: %v\n", key, contact.String(), err)
+			continue
+		}
+		replicas++
+		repaired++
+	}
+	return replicas, min(wanted, node.config.K), repaired
+}
+
+// ReplicaStats returns the result of the most recent replica audit
+func (node *Node) ReplicaStats() ReplicaStats {
+	node.auditMu.Lock()
+	defer node.auditMu.Unlock()
+	return node.replicaStats
+}
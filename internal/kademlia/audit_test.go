@@ -0,0 +1,109 @@
+package kademlia
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MockClientAudit answers FIND_VALUE only for the contacts in holders and records every repair
+type MockClientAudit struct {
+	MockClient
+	holders  map[string]bool
+	failTo   map[string]bool
+	repaired []string
+	mu       sync.Mutex
+}
+
+func (mc *MockClientAudit) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	if mc.holders[contact.Address] {
+		return RPCMessage{Payload: Payload{Key: key, Data: []byte("value")}}, nil
+	}
+	return RPCMessage{Payload: Payload{Key: key}}, nil
+}
+
+func (mc *MockClientAudit) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	if mc.failTo[contact.Address] {
+		return fmt.Errorf("unreachable")
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.repaired = append(mc.repaired, contact.Address)
+	return nil
+}
+
+func newAuditNode(t *testing.T, client *MockClientAudit) *Node {
+	t.Helper()
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(client)
+	for i := 1; i <= 3; i++ {
+		node.AddContact(Contact{ID: NewKademliaID(fmt.Sprintf("%040x", i)), Address: fmt.Sprintf("1.2.3.4:%d", i)})
+	}
+	node.Storage.Put(NewKademliaIDFromData([]byte("value")).String(), Record{Data: []byte("value"), Publisher: true})
+	return node
+}
+
+func Test_Audit_RepairsMissingReplicas(t *testing.T) {
+	client := &MockClientAudit{holders: map[string]bool{"1.2.3.4:1": true}}
+	node := newAuditNode(t, client)
+
+	stats := node.AuditReplicas()
+	assert.Equal(t, 1, stats.Audited)
+	assert.Equal(t, 2, stats.Repaired)
+	assert.Empty(t, stats.UnderReplicated)
+	assert.ElementsMatch(t, []string{"1.2.3.4:2", "1.2.3.4:3"}, client.repaired)
+	assert.Equal(t, stats, node.ReplicaStats())
+}
+
+func Test_Audit_ReportsUnderReplicated(t *testing.T) {
+	client := &MockClientAudit{
+		holders: map[string]bool{"1.2.3.4:1": true},
+		failTo:  map[string]bool{"1.2.3.4:2": true, "1.2.3.4:3": true},
+	}
+	node := newAuditNode(t, client)
+
+	stats := node.AuditReplicas()
+	assert.Equal(t, 0, stats.Repaired)
+	assert.Equal(t, []UnderReplicatedKey{{Key: NewKademliaIDFromData([]byte("value")).String(), Replicas: 1}}, stats.UnderReplicated)
+}
+
+func Test_Audit_SkipsCached(t *testing.T) {
+	client := &MockClientAudit{}
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(client)
+	node.Storage.Put(NewKademliaIDFromData([]byte("value")).String(), Record{Data: []byte("value"), Cached: true})
+
+	stats := node.AuditReplicas()
+	assert.Equal(t, 0, stats.Audited)
+	assert.Empty(t, client.repaired)
+}
+
+func Test_Audit_RepairsLostReplicaInNetwork(t *testing.T) {
+	nodes := newMockCluster(t, 5150, 4)
+	data := []byte("audited")
+	key := NewKademliaIDFromData(data).String()
+
+	_, err := nodes[1].Node.Publish(data)
+	assert.NoError(t, err)
+
+	// One replica loses the value, the publisher's audit puts it back
+	var lost *Kademlia
+	for _, node := range nodes {
+		if node != nodes[1] && node.Node.LookupData(key) != nil {
+			lost = node
+			break
+		}
+	}
+	if !assert.NotNil(t, lost) {
+		return
+	}
+	assert.NoError(t, lost.Node.Storage.Delete(key))
+
+	stats := nodes[1].Node.AuditReplicas()
+	assert.Equal(t, 1, stats.Audited)
+	assert.Positive(t, stats.Repaired)
+	assert.NotNil(t, lost.Node.LookupData(key))
+}
@@ -3,44 +3,126 @@ package kademlia
 import (
 	"container/list"
 	"sync"
+	"time"
 )
 
 // bucket definition
-// contains a List
+// contains a List of contacts, most recently seen first, and a replacement cache of the
+// contacts seen while the bucket was full, also most recently seen first. Both hold up to k contacts
 type bucket struct {
-	list *list.List
-	mu   sync.RWMutex
+	k            int
+	list         *list.List
+	replacements *list.List
+	lookedUpAt   time.Time                   // last node lookup for an ID in the bucket's range
+	liveness     map[string]*ContactLiveness // of the contacts in list, by ID
+	mu           sync.RWMutex
 }
 
-// newBucket returns a new instance of a bucket
-func newBucket() *bucket {
-	bucket := &bucket{}
+// newBucket returns a new instance of a bucket holding up to k contacts
+func newBucket(k int) *bucket {
+	bucket := &bucket{k: k}
 	bucket.list = list.New()
+	bucket.replacements = list.New()
+	bucket.liveness = make(map[string]*ContactLiveness)
+	bucket.lookedUpAt = time.Now()
 	return bucket
 }
 
 // AddContact adds the Contact to the front of the bucket
-// or moves it to the front of the bucket if it already existed
+// or moves it to the front of the bucket if it already existed.
+// When the bucket is full the contact goes to the front of the replacement cache instead
 func (bucket *bucket) AddContact(contact Contact) {
 	bucket.mu.Lock()
 	defer bucket.mu.Unlock()
 
-	var element *list.Element
-	for e := bucket.list.Front(); e != nil; e = e.Next() {
-		nodeID := e.Value.(Contact).ID
+	if element := findContact(bucket.list, contact.ID); element != nil {
+		bucket.list.MoveToFront(element)
+		return
+	}
+	if replacement := findContact(bucket.replacements, contact.ID); replacement != nil {
+		bucket.replacements.Remove(replacement)
+	}
+	if bucket.list.Len() < bucket.k {
+		bucket.list.PushFront(contact)
+		return
+	}
 
-		if (contact).ID.Equals(nodeID) {
-			element = e
-		}
+	bucket.replacements.PushFront(contact)
+	if bucket.replacements.Len() > bucket.k {
+		bucket.replacements.Remove(bucket.replacements.Back())
 	}
+}
+
+// Contains reports whether the contact with id is in the bucket, not counting the replacement cache
+func (bucket *bucket) Contains(id *KademliaID) bool {
+	bucket.mu.RLock()
+	defer bucket.mu.RUnlock()
+	return findContact(bucket.list, id) != nil
+}
 
+// RemoveContact removes the contact with id from the bucket and promotes the most recently seen
+// replacement in its place. Reports whether the contact was removed
+func (bucket *bucket) RemoveContact(id *KademliaID) bool {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	element := findContact(bucket.list, id)
 	if element == nil {
-		if bucket.list.Len() < bucketSize {
-			bucket.list.PushFront(contact)
+		return false
+	}
+	bucket.list.Remove(element)
+	delete(bucket.liveness, id.String())
+	bucket.promote()
+	return true
+}
+
+// ReplaceContact replaces the contact with id by the most recently seen replacement, but only if
+// there is one, so a bucket never shrinks because one of its contacts failed to answer once.
+// Reports whether the contact was replaced
+func (bucket *bucket) ReplaceContact(id *KademliaID) bool {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	element := findContact(bucket.list, id)
+	if element == nil || bucket.replacements.Len() == 0 {
+		return false
+	}
+	bucket.list.Remove(element)
+	delete(bucket.liveness, id.String())
+	bucket.promote()
+	return true
+}
+
+// promote moves the most recently seen replacement into the bucket, callers must hold bucket.mu.
+// It goes to the back of the bucket since it has not been heard from since it was cached
+func (bucket *bucket) promote() {
+	front := bucket.replacements.Front()
+	if front == nil || bucket.list.Len() >= bucket.k {
+		return
+	}
+	bucket.replacements.Remove(front)
+	bucket.list.PushBack(front.Value.(Contact))
+}
+
+// Replacements returns the replacement cache, most recently seen first
+func (bucket *bucket) Replacements() []Contact {
+	bucket.mu.RLock()
+	defer bucket.mu.RUnlock()
+	var contacts []Contact
+	for e := bucket.replacements.Front(); e != nil; e = e.Next() {
+		contacts = append(contacts, e.Value.(Contact))
+	}
+	return contacts
+}
+
+// findContact returns the element of l holding the contact with id, or nil
+func findContact(l *list.List, id *KademliaID) *list.Element {
+	for e := l.Front(); e != nil; e = e.Next() {
+		if e.Value.(Contact).ID.Equals(id) {
+			return e
 		}
-	} else {
-		bucket.list.MoveToFront(element)
 	}
+	return nil
 }
 
 // GetContactAndCalcDistance returns an array of Contacts where
@@ -60,6 +142,13 @@ func (bucket *bucket) GetContactAndCalcDistance(target *KademliaID) []Contact {
 	return contacts
 }
 
+// Full reports whether the bucket holds k contacts
+func (bucket *bucket) Full() bool {
+	bucket.mu.RLock()
+	defer bucket.mu.RUnlock()
+	return bucket.list.Len() >= bucket.k
+}
+
 // Len return the size of the bucket
 func (bucket *bucket) Len() int {
 
@@ -7,7 +7,7 @@ import (
 )
 
 func TestLen(t *testing.T) {
-	bucket := newBucket()
+	bucket := newBucket(bucketSize)
 
 	assert.True(t, bucket.Len() == 0)
 
@@ -19,7 +19,7 @@ func TestLen(t *testing.T) {
 }
 
 func TestAddContact(t *testing.T) {
-	bucket := newBucket()
+	bucket := newBucket(bucketSize)
 
 	// Add c1 to bucket and confirm it's at the front of the list
 	contact1 := NewContact(NewRandomKademliaID(), "0.0.0.0:1234")
@@ -35,3 +35,52 @@ func TestAddContact(t *testing.T) {
 	bucket.AddContact(contact1)
 	assert.True(t, bucket.list.Front().Value == contact1)
 }
+
+func TestReplacementCache(t *testing.T) {
+	bucket := newBucket(bucketSize)
+	for i := 0; i < bucketSize; i++ {
+		bucket.AddContact(NewContact(NewRandomKademliaID(), "0.0.0.0:1234"))
+	}
+
+	// Contacts seen while the bucket is full are cached, most recent first and bounded
+	var candidates []Contact
+	for i := 0; i < bucketSize+5; i++ {
+		candidate := NewContact(NewRandomKademliaID(), "0.0.0.0:5678")
+		candidates = append(candidates, candidate)
+		bucket.AddContact(candidate)
+	}
+	assert.Equal(t, bucketSize, bucket.Len())
+	replacements := bucket.Replacements()
+	assert.Len(t, replacements, bucketSize)
+	assert.Equal(t, candidates[len(candidates)-1], replacements[0])
+
+	// Seeing a cached candidate again moves it to the front of the cache
+	bucket.AddContact(candidates[10])
+	assert.Equal(t, candidates[10], bucket.Replacements()[0])
+
+	// Removing a resident promotes the most recently seen candidate
+	resident := bucket.list.Front().Value.(Contact)
+	assert.True(t, bucket.RemoveContact(resident.ID))
+	assert.False(t, bucket.Contains(resident.ID))
+	assert.True(t, bucket.Contains(candidates[10].ID))
+	assert.Equal(t, bucketSize, bucket.Len())
+	assert.Len(t, bucket.Replacements(), bucketSize-1)
+	assert.False(t, bucket.RemoveContact(resident.ID))
+}
+
+func TestReplaceContact(t *testing.T) {
+	bucket := newBucket(bucketSize)
+	contact := NewContact(NewRandomKademliaID(), "0.0.0.0:1234")
+	bucket.AddContact(contact)
+
+	// Without a candidate the contact is kept
+	assert.False(t, bucket.ReplaceContact(contact.ID))
+	assert.True(t, bucket.Contains(contact.ID))
+
+	candidate := NewContact(NewRandomKademliaID(), "0.0.0.0:5678")
+	bucket.replacements.PushFront(candidate)
+	assert.True(t, bucket.ReplaceContact(contact.ID))
+	assert.False(t, bucket.Contains(contact.ID))
+	assert.True(t, bucket.Contains(candidate.ID))
+	assert.Empty(t, bucket.Replacements())
+}
@@ -4,16 +4,20 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 )
 
+// cliCommands lists the commands Cli accepts, shown in its prompt and for unknown commands
+const cliCommands = "put <content>, get <hash>, putfile <path>, getfile <hash> <path>, delete <hash>, export <path>, import <path> [republish], keys, keyinfo <hash>, storage stats, leave, exit"
+
 // Cli provides a simple command-line interface for the Kademlia node
 func (node *Node) Cli(in io.Reader, out io.Writer) {
 	reader := bufio.NewReader(in)
-	fmt.Fprintln(out, "Node CLI started. Commands: put <content>, get <hash>, exit")
+	fmt.Fprintln(out, "Node CLI started. Commands: "+cliCommands)
 
 	for {
-		fmt.Fprintln(out, "Commands: put <content>, get <hash>, exit")
+		fmt.Fprintln(out, "Commands: "+cliCommands)
 		fmt.Fprint(out, "> ")
 		input, _ := reader.ReadString('\n')
 		input = strings.TrimSpace(input)
@@ -46,19 +50,116 @@ func (node *Node) Cli(in io.Reader, out io.Writer) {
 			} else {
 				fmt.Fprint(out, result)
 			}
+		case "delete":
+			if len(parts) < 2 {
+				fmt.Fprintln(out, "Usage: delete <hash>")
+				continue
+			}
+			result, err := node.Delete(parts[1])
+			if err != nil {
+				fmt.Fprintln(out, "Error deleting content:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "putfile":
+			if len(parts) < 2 {
+				fmt.Fprintln(out, "Usage: putfile <path>")
+				continue
+			}
+			result, err := node.PutFile(parts[1])
+			if err != nil {
+				fmt.Fprintln(out, "Error storing file:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "getfile":
+			args := []string{}
+			if len(parts) == 2 {
+				args = strings.Fields(parts[1])
+			}
+			if len(args) < 2 {
+				fmt.Fprintln(out, "Usage: getfile <hash> <path>")
+				continue
+			}
+			result, err := node.GetFile(args[0], args[1])
+			if err != nil {
+				fmt.Fprintln(out, "Error retrieving file:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "export":
+			if len(parts) < 2 {
+				fmt.Fprintln(out, "Usage: export <path>")
+				continue
+			}
+			result, err := node.ExportFile(parts[1])
+			if err != nil {
+				fmt.Fprintln(out, "Error exporting values:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "import":
+			args := []string{}
+			if len(parts) == 2 {
+				args = strings.Fields(parts[1])
+			}
+			if len(args) < 1 || (len(args) == 2 && args[1] != "republish") || len(args) > 2 {
+				fmt.Fprintln(out, "Usage: import <path> [republish]")
+				continue
+			}
+			result, err := node.ImportFile(args[0], len(args) == 2)
+			if err != nil {
+				fmt.Fprintln(out, "Error importing values:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "keys":
+			fmt.Fprint(out, node.ListKeys())
+		case "keyinfo":
+			if len(parts) < 2 {
+				fmt.Fprintln(out, "Usage: keyinfo <hash>")
+				continue
+			}
+			result, err := node.DescribeKey(parts[1])
+			if err != nil {
+				fmt.Fprintln(out, "Error describing key:", err)
+			} else {
+				fmt.Fprint(out, result)
+			}
+		case "storage":
+			if len(parts) < 2 || parts[1] != "stats" {
+				fmt.Fprintln(out, "Usage: storage stats")
+				continue
+			}
+			fmt.Fprint(out, node.DescribeStorage())
+		case "leave":
+			if node.leave == nil {
+				fmt.Fprintln(out, "Error leaving network: node is not running")
+				continue
+			}
+			if err := node.leave(); err != nil {
+				fmt.Fprintln(out, "Error handing off values:", err)
+			}
+			fmt.Fprintln(out, "Left the network.")
+			return
 		case "exit":
+			// Stop the periodic tasks first, so the routing table saved is the last one
+			node.Stop()
+			if err := node.SaveRoutingTable(); err != nil {
+				fmt.Fprintln(out, "Error saving routing table:", err)
+			}
 			fmt.Fprintln(out, "Shutting down node.")
 			return
 		case "print":
 			node.PrintRoutingTable()
 		default:
-			fmt.Fprintln(out, "Unknown command. Use put <content>, get <hash>, or exit.")
+			fmt.Fprintln(out, "Unknown command. Commands: "+cliCommands)
 		}
 	}
 }
 
 func (node *Node) Put(content string) (string, error) {
-	ans, err := node.Client.SendStoreMessage([]byte(content))
+	ans, err := node.Publish([]byte(content))
 	if err != nil {
 		return "", err
 	}
@@ -77,3 +178,42 @@ func (node *Node) Get(hash string) (string, error) {
 	result := fmt.Sprintf("Content retrieved!\nHash: %s\nContent: %s\nSource: %s\n", ans.Payload.Key, ans.Payload.Data, ans.Payload.SourceContact.ID.String())
 	return result, nil
 }
+
+// Delete deletes a value or file this node published, for files together with the chunks no other
+// published file shares
+func (node *Node) Delete(hash string) (string, error) {
+	chunks, err := node.DeleteLarge(hash)
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("Content deleted!\nHash: %s\n", hash)
+	if chunks > 0 {
+		result += fmt.Sprintf("Chunks: %d\n", chunks)
+	}
+	return result, nil
+}
+
+func (node *Node) PutFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key, err := node.PutLarge(data)
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("File stored!\nHash: %s\nSize: %d bytes\n", key, len(data))
+	return result, nil
+}
+
+func (node *Node) GetFile(hash string, path string) (string, error) {
+	data, err := node.GetLarge(hash)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("File retrieved!\nHash: %s\nSize: %d bytes\nPath: %s\n", hash, len(data), path)
+	return result, nil
+}
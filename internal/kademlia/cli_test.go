@@ -2,8 +2,11 @@ package kademlia
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,6 +27,13 @@ func Test_Node_Cli_PutGetExit(t *testing.T) {
 	assert.Contains(t, output, "Content: testdata")
 	assert.Contains(t, output, "Source: 1234567891234567891234567891234567891234")
 	assert.Contains(t, output, "Shutting down node.")
+
+	// exit stops the periodic tasks before the routing table is saved
+	select {
+	case <-node.done:
+	default:
+		t.Error("node still running after exit")
+	}
 }
 
 func Test_Node_Cli_UnknownCommand(t *testing.T) {
@@ -34,7 +44,7 @@ func Test_Node_Cli_UnknownCommand(t *testing.T) {
 	out := &bytes.Buffer{}
 	node.Cli(in, out)
 	output := out.String()
-	assert.Contains(t, output, "Unknown command. Use put <content>, get <hash>, or exit.")
+	assert.Contains(t, output, "Unknown command. Commands: "+cliCommands)
 	assert.Contains(t, output, "Shutting down node.")
 }
 
@@ -62,6 +72,82 @@ func Test_Node_Cli_Get_Error(t *testing.T) {
 	assert.Contains(t, output, "Shutting down node.")
 }
 
+func Test_Node_Cli_Delete(t *testing.T) {
+	node, _ := InitNode(true, "localhost:9108", "")
+	node.SetClient(&MockClientCLI{})
+	key := NewKademliaIDFromData([]byte("testdata")).String()
+	out := &bytes.Buffer{}
+	node.Cli(strings.NewReader("delete "+key+"\ndelete\ndelete nothex\nexit\n"), out)
+	assert.Contains(t, out.String(), "Content deleted!\nHash: "+key)
+	assert.Contains(t, out.String(), "Usage: delete <hash>")
+	assert.Contains(t, out.String(), "Error deleting content:")
+
+	record, ok := node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.True(t, record.Tombstone)
+}
+
+func Test_Node_Cli_Leave(t *testing.T) {
+	nodes := newMockCluster(t, 5140, 3)
+	data := []byte("cli handoff")
+	key := NewKademliaIDFromData(data).String()
+	assert.NoError(t, nodes[2].Node.Store(key, Record{Data: data}))
+
+	out := &bytes.Buffer{}
+	nodes[2].Node.Cli(strings.NewReader("leave\n"), out)
+	assert.Contains(t, out.String(), "Left the network.")
+	assert.NotContains(t, out.String(), "Error")
+
+	_, err := nodes[0].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+}
+
+func Test_Node_Cli_Leave_NotRunning(t *testing.T) {
+	node, _ := InitNode(true, "localhost:9104", "")
+	node.SetClient(&MockClientCLI{})
+	out := &bytes.Buffer{}
+	node.Cli(strings.NewReader("leave\nexit\n"), out)
+	assert.Contains(t, out.String(), "Error leaving network: node is not running")
+	assert.Contains(t, out.String(), "Shutting down node.")
+}
+
+func Test_Node_Cli_ExportImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	value := []byte("exported")
+	key := NewKademliaIDFromData(value).String()
+
+	source, _ := InitNode(true, "localhost:9105", "")
+	source.SetClient(&MockClientCLI{})
+	assert.NoError(t, source.Store(key, Record{Data: value}))
+	out := &bytes.Buffer{}
+	source.Cli(strings.NewReader("export "+path+"\nexit\n"), out)
+	assert.Contains(t, out.String(), "Exported 1 values")
+
+	target, _ := InitNode(true, "localhost:9106", "")
+	target.SetClient(&MockClientCLI{})
+	out = &bytes.Buffer{}
+	target.Cli(strings.NewReader("import "+path+" republish\nimport\nexit\n"), out)
+	assert.Contains(t, out.String(), "Imported 1 values")
+	assert.Contains(t, out.String(), "Usage: import <path> [republish]")
+	assert.Equal(t, value, target.LookupData(key))
+}
+
+func Test_Node_Cli_KeysKeyinfoStorage(t *testing.T) {
+	value := []byte("listed")
+	key := NewKademliaIDFromData(value).String()
+	node, _ := InitNode(true, "localhost:9107", "")
+	node.SetClient(&MockClientCLI{})
+	assert.NoError(t, node.Store(key, Record{Data: value}))
+
+	out := &bytes.Buffer{}
+	node.Cli(strings.NewReader("keys\nkeyinfo "+key+"\nkeyinfo\nstorage stats\nstorage\nexit\n"), out)
+	assert.Contains(t, out.String(), "1 keys stored\n"+key+" 6 bytes replica")
+	assert.Contains(t, out.String(), "Key: "+key)
+	assert.Contains(t, out.String(), "Usage: keyinfo <hash>")
+	assert.Contains(t, out.String(), "Keys: 1\nBytes: 6\nLimit: unlimited")
+	assert.Contains(t, out.String(), "Usage: storage stats")
+}
+
 // MockClient for CLI tests
 type MockClientCLI struct{}
 
@@ -74,6 +160,12 @@ func (mc *MockClientCLI) SendFindNodeMessage(target *KademliaID, contact Contact
 func (mc *MockClientCLI) SendStoreMessage(data []byte) (RPCMessage, error) {
 	return RPCMessage{Payload: Payload{Key: "testhash"}, PacketID: "packet123"}, nil
 }
+func (mc *MockClientCLI) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{Payload: Payload{Key: key}, PacketID: "packet123"}, nil
+}
+func (mc *MockClientCLI) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{Payload: Payload{Key: key}, PacketID: "packet123"}, nil
+}
 func (mc *MockClientCLI) SendFindValueMessage(hash string) (RPCMessage, error) {
 	return RPCMessage{
 		Payload: Payload{
@@ -83,6 +175,15 @@ func (mc *MockClientCLI) SendFindValueMessage(hash string) (RPCMessage, error) {
 		},
 	}, nil
 }
+func (mc *MockClientCLI) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClientCLI) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	return nil
+}
+func (mc *MockClientCLI) SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error) {
+	return MerkleSummary{Prefix: prefix}, nil
+}
 
 func Test_Node_Put_Success(t *testing.T) {
 	node, _ := InitNode(true, "localhost:9000", "")
@@ -90,7 +191,7 @@ func Test_Node_Put_Success(t *testing.T) {
 	result, err := node.Put("somedata")
 	assert.NoError(t, err)
 	assert.Contains(t, result, "Content stored!")
-	assert.Contains(t, result, "Hash: testhash")
+	assert.Contains(t, result, "Hash: "+NewKademliaIDFromData([]byte("somedata")).String())
 	assert.Contains(t, result, "Packet ID: packet123")
 }
 
@@ -113,9 +214,24 @@ func (mc *MockClientError) SendFindNodeMessage(target *KademliaID, contact Conta
 func (mc *MockClientError) SendStoreMessage(data []byte) (RPCMessage, error) {
 	return RPCMessage{}, assert.AnError
 }
+func (mc *MockClientError) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, assert.AnError
+}
+func (mc *MockClientError) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, assert.AnError
+}
 func (mc *MockClientError) SendFindValueMessage(hash string) (RPCMessage, error) {
 	return RPCMessage{}, nil
 }
+func (mc *MockClientError) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClientError) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	return assert.AnError
+}
+func (mc *MockClientError) SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error) {
+	return MerkleSummary{}, assert.AnError
+}
 
 func Test_Node_Get_Success(t *testing.T) {
 	node, _ := InitNode(true, "localhost:9002", "")
@@ -135,3 +251,35 @@ func Test_Node_Get_Error(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, result)
 }
+
+func Test_Node_Cli_PutFileGetFile(t *testing.T) {
+	node, _ := InitNode(true, "localhost:9104", "")
+	node.SetClient(&MockClientStore{})
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.bin")
+	dst := filepath.Join(dir, "out.bin")
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	os.WriteFile(src, data, 0o644)
+
+	result, err := node.PutFile(src)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "File stored!")
+	hash := strings.TrimPrefix(strings.Split(result, "\n")[1], "Hash: ")
+
+	in := strings.NewReader("getfile " + hash + " " + dst + "\nexit\n")
+	out := &bytes.Buffer{}
+	node.Cli(in, out)
+	assert.Contains(t, out.String(), "File retrieved!")
+	written, _ := os.ReadFile(dst)
+	assert.Equal(t, data, written)
+}
+
+func Test_Node_Cli_GetFile_Usage(t *testing.T) {
+	node, _ := InitNode(true, "localhost:9105", "")
+	node.SetClient(&MockClientStore{})
+	in := strings.NewReader("getfile onlyhash\nputfile\nexit\n")
+	out := &bytes.Buffer{}
+	node.Cli(in, out)
+	assert.Contains(t, out.String(), "Usage: getfile <hash> <path>")
+	assert.Contains(t, out.String(), "Usage: putfile <path>")
+}
@@ -1,17 +1,21 @@
 package kademlia
 
 import (
-	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+const minCacheTTL = time.Minute
+
 type Client struct {
 	node    NodeAPI
 	network Network
+	config  *KademliaConfig
 	pending sync.Map
 	done    chan struct{}
 }
@@ -20,14 +24,24 @@ type ClientAPI interface {
 	SendPingMessage(target Contact) (RPCMessage, error)
 	SendFindNodeMessage(target *KademliaID, contact Contact) ([]Contact, error)
 	SendStoreMessage(data []byte) (RPCMessage, error)
+	SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error)
+	SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error)
 	SendFindValueMessage(hash string) (RPCMessage, error)
+	SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error)
+	SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error
+	SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error)
 }
 
 func InitClient(node NodeAPI, network Network) (*Client, error) {
+	return newClient(node, network, defaultConfig())
+}
+
+func newClient(node NodeAPI, network Network, cfg *KademliaConfig) (*Client, error) {
 
 	c := &Client{
 		node:    node,
 		network: network,
+		config:  cfg,
 		done:    make(chan struct{}),
 	}
 
@@ -90,6 +104,21 @@ func (client *Client) SendMessage(target Contact, msg *RPCMessage) (chan RPCMess
 	return respChan, nil
 }
 
+// await waits up to timeout for the reply to a request sent to target. The responder is added to
+// the routing table, and the node learns whether target answered and how long it took
+func (client *Client) await(target Contact, respChan chan RPCMessage, timeout time.Duration) (RPCMessage, bool) {
+	sentAt := time.Now()
+	select {
+	case resp := <-respChan:
+		client.node.AddContact(resp.Payload.SourceContact)
+		client.node.ContactResponded(target, time.Since(sentAt))
+		return resp, true
+	case <-time.After(timeout):
+		client.node.ContactFailed(target)
+		return RPCMessage{}, false
+	}
+}
+
 func (client *Client) SendPingMessage(target Contact) (RPCMessage, error) {
 
 	request := NewRPCMessage("PING", Payload{}, true)
@@ -99,12 +128,11 @@ func (client *Client) SendPingMessage(target Contact) (RPCMessage, error) {
 	}
 
 	// Wait for response
-	select {
-	case resp := <-respChan:
-		return resp, nil
-	case <-time.After(500 * time.Millisecond):
+	resp, ok := client.await(target, respChan, 500*time.Millisecond)
+	if !ok {
 		return RPCMessage{}, fmt.Errorf("PING Timeout")
 	}
+	return resp, nil
 }
 
 // JOIN, PING BOOTSTRAP, FIND_NODE SELF -> UNTIL DISTANCE ISN'T GETTING SMALLER
@@ -122,18 +150,17 @@ func (client *Client) SendFindNodeMessage(target *KademliaID, contact Contact) (
 	}
 
 	// Wait for response
-	select {
-	case resp := <-respChan:
-		if resp.Payload.SourceContact != (Contact{}) {
-			client.node.AddContact(resp.Payload.SourceContact)
-		}
-		for _, c := range resp.Payload.Contacts {
-			client.node.AddContact(c)
-		}
-		return resp.Payload.Contacts, nil
-	case <-time.After(2 * time.Second):
+	resp, ok := client.await(contact, respChan, 2*time.Second)
+	if !ok {
 		return nil, fmt.Errorf("FIND_NODE Timeout")
 	}
+	if resp.Payload.Error != "" {
+		return nil, fmt.Errorf("FIND_NODE refused by %s: %s", contact.String(), resp.Payload.Error)
+	}
+	for _, c := range resp.Payload.Contacts {
+		client.node.AddContact(c)
+	}
+	return resp.Payload.Contacts, nil
 }
 
 // When part of a network, it must be possible for any node to upload an object
@@ -142,43 +169,73 @@ func (client *Client) SendFindNodeMessage(target *KademliaID, contact Contact) (
 // Data objects are always UTF-8 strings
 func (client *Client) SendStoreMessage(data []byte) (RPCMessage, error) {
 	// Use a hashing method to generate a KademliaID key from the data
-	hash := sha1.Sum(data)
-	key := NewKademliaID(fmt.Sprintf("%x", hash[:]))
+	key := client.config.KeySpace.Sum(data)
+	return client.SendStoreValueMessage(key.String(), Record{Data: data}, client.config.ValueTTL)
+}
+
+// SendStoreValueMessage stores the value of record under an explicit key at the nodes closest
+// to it, asking them to keep it for ttl. It is used for mutable records and when re-sending
+// values that are already stored
+func (client *Client) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return client.sendStoreValue("STORE", key, record, ttl)
+}
+
+// SendDeleteMessage sends the tombstone record deleting the value under key to the nodes closest
+// to it, asking them to keep it for ttl
+func (client *Client) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return client.sendStoreValue("DELETE", key, record, ttl)
+}
 
-	// Find closest nodes to the generated key
-	closest, err := client.node.IterativeFindNode(key)
+// sendStoreValue sends a STORE or DELETE request for record to the nodes closest to key
+func (client *Client) sendStoreValue(msgType string, key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	keyID, err := client.config.KeySpace.Parse(key)
+	if err != nil {
+		return RPCMessage{}, err
+	}
+
+	// Find closest nodes to the key
+	closest, err := client.node.IterativeFindNode(keyID)
 	if err != nil || len(closest) == 0 {
 		return RPCMessage{}, fmt.Errorf("no nodes found to store data")
 	}
 
-	k := alpha // minimum number of nodes to store
+	ttlSeconds := int64(ttl / time.Second)
+	k := client.config.K // number of nodes to store at
 	storedCount := 0
 	var lastResp RPCMessage
+	var stale error // a node holds a newer record, so this one must not be spread any further
 
 	for _, contact := range closest {
-		request := NewRPCMessage("STORE", Payload{Key: key.String(), Data: data}, true)
+		payload := Payload{Key: keyID.String(), TTL: ttlSeconds}.withRecord(record)
+		request := NewRPCMessage(msgType, payload, true)
 		respChan, err := client.SendMessage(contact, request)
 		if err != nil {
 			continue
 		}
 
-		select {
-		case resp := <-respChan:
-			client.node.AddContact(resp.Payload.SourceContact)
-			////log.Println("STORE response received")
-			// Assume any response means successful store
-
-			storedCount++
-			lastResp = resp
-			if storedCount >= k {
-				return lastResp, nil
+		resp, ok := client.await(contact, respChan, 2*time.Second)
+		if !ok {
+			log.Println(msgType, "Timeout for contact", contact.String())
+			continue // try next contact
+		}
+		if resp.Payload.Error != "" {
+			log.Printf("%s refused by %s: %s\n", msgType, contact.String(), resp.Payload.Error)
+			if strings.Contains(resp.Payload.Error, ErrStaleSequence.Error()) {
+				stale = fmt.Errorf("%w: refused by %s", ErrStaleSequence, contact.String())
 			}
-		case <-time.After(2 * time.Second):
-			log.Println("STORE Timeout for contact", contact.String())
-			// try next contact
+			continue
+		}
+
+		storedCount++
+		lastResp = resp
+		if storedCount >= k {
+			break
 		}
 	}
 
+	if stale != nil {
+		return lastResp, stale
+	}
 	if storedCount > 0 {
 		return lastResp, nil
 	}
@@ -187,46 +244,241 @@ func (client *Client) SendStoreMessage(data []byte) (RPCMessage, error) {
 	return RPCMessage{}, fmt.Errorf("data could not be stored on any nodes")
 }
 
-// When part of a network with uploaded objects, it must be possible to find and
-// download any object, as long as it is stored by at least one designated node.
-func (client *Client) SendFindValueMessage(hash string) (RPCMessage, error) {
+// cacheValue stores a copy of a value found by a lookup on cacheAt, a node on the lookup path that
+// did not have it, so popular values spread out from the k closest nodes. between is the number of
+// nodes the lookup knows closer to the key than cacheAt
+func (client *Client) cacheValue(key string, record Record, cacheAt Contact, between int) {
+	ttl := cacheTTL(between, client.config.ValueTTL)
+	payload := Payload{Key: key, TTL: int64(ttl / time.Second), Cache: true}.withRecord(record)
+	if err := client.storeAt(cacheAt, payload); err != nil {
+		log.Printf("failed to cache %s at %s: %v\n", key, cacheAt.String(), err)
+	}
+}
 
-	key := NewKademliaID(hash)
+// cacheTTL halves the value TTL for a copy cached at the closest known node of the key, and
+// again for every node between the cache node and the key, so cached copies far from the key
+// expire quickly
+func cacheTTL(between int, ttl time.Duration) time.Duration {
+	return max(ttl>>min(between+1, 30), minCacheTTL)
+}
 
-	// First, check if we have have the value ourself
-	data := client.node.LookupData(key.String())
-	if data != nil {
-		return *NewRPCMessage("FIND_VALUE", Payload{Key: key.String(), Data: data}, false), nil
+// cacheTarget returns the closest node of a value lookup that was asked for the value and did not
+// hold it, as in the Kademlia paper. shortlist is every node the lookup knows, closest to the key
+// first, so the index of the node in it is the number of known nodes between it and the key
+func cacheTarget(shortlist []Contact, missed map[string]bool) (cacheAt Contact, between int, ok bool) {
+	for i := range shortlist {
+		if missed[shortlist[i].ID.String()] {
+			return shortlist[i], i, true
+		}
 	}
+	return Contact{}, 0, false
+}
+
+// SendStoreAtMessage stores record under key at a single contact, asking it to keep it for ttl
+func (client *Client) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	return client.storeAt(contact, Payload{Key: key, TTL: int64(ttl / time.Second)}.withRecord(record))
+}
 
-	// Get nodes closest to the key
-	closest, err := client.node.IterativeFindNode(key)
+// SendFindValueAtMessage asks a single contact for the value stored under key.
+// A reply without data means the contact does not hold it, invalid data is reported as an error
+func (client *Client) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	request := NewRPCMessage("FIND_VALUE", Payload{Key: key}, true)
+	respChan, err := client.SendMessage(contact, request)
 	if err != nil {
 		return RPCMessage{}, err
 	}
+	resp, ok := client.await(contact, respChan, 2*time.Second)
+	if !ok {
+		return RPCMessage{}, fmt.Errorf("FIND_VALUE Timeout")
+	}
+	if resp.Payload.hasValue() {
+		if err := verifyValue(key, resp.Payload); err != nil {
+			return RPCMessage{}, fmt.Errorf("invalid data from %s: %w", contact.String(), err)
+		}
+	}
+	return resp, nil
+}
+
+// SendSyncTreeMessage asks contact for its Merkle summary of the values under prefix
+func (client *Client) SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error) {
+	request := NewRPCMessage("SYNC_TREE", Payload{Key: prefix}, true)
+	respChan, err := client.SendMessage(contact, request)
+	if err != nil {
+		return MerkleSummary{}, err
+	}
+	resp, ok := client.await(contact, respChan, 2*time.Second)
+	if !ok {
+		return MerkleSummary{}, fmt.Errorf("SYNC_TREE Timeout")
+	}
+	if resp.Payload.Summary == nil {
+		return MerkleSummary{}, fmt.Errorf("SYNC_TREE reply without summary")
+	}
+	return *resp.Payload.Summary, nil
+}
+
+// handoff stores record at every node closest to key other than this one, waiting for each of them
+// to acknowledge it. Returns the number of nodes that accepted the value
+func (client *Client) handoff(key string, record Record, ttl time.Duration) (int, error) {
+	keyID, err := client.config.KeySpace.Parse(key)
+	if err != nil {
+		return 0, err
+	}
+	closest, err := client.node.IterativeFindNode(keyID)
+	if err != nil {
+		return 0, err
+	}
 
-	// Check with each node if they have the value
+	self := client.node.GetSelfContact()
+	accepted := 0
 	for _, contact := range closest {
-		request := NewRPCMessage("FIND_VALUE", Payload{Key: key.String()}, true)
-		respChan, err := client.SendMessage(contact, request)
-		if err != nil {
+		if contact.ID == nil || contact.ID.Equals(self.ID) {
+			continue
+		}
+		if err := client.SendStoreAtMessage(key, record, ttl, contact); err != nil {
+			log.Printf("failed to hand off %s to %s: %v\n", key, contact.String(), err)
 			continue
 		}
+		accepted++
+		// Erasure shards are only kept at ShardReplicas nodes
+		if record.Shard && accepted == client.config.ShardReplicas {
+			break
+		}
+	}
+	if accepted == 0 {
+		return 0, fmt.Errorf("no other node accepted %s", key)
+	}
+	return accepted, nil
+}
 
-		select {
-		case resp := <-respChan:
-			//log.Println("FIND_VALUE response received")
-			client.node.AddContact(resp.Payload.SourceContact)
-			if resp.Payload.Data != nil {
-				// Found the data, return immediately
-				return resp, nil
+// storeAt sends a single STORE to contact and waits for it to be accepted
+func (client *Client) storeAt(contact Contact, payload Payload) error {
+	request := NewRPCMessage("STORE", payload, true)
+	respChan, err := client.SendMessage(contact, request)
+	if err != nil {
+		return err
+	}
+	resp, ok := client.await(contact, respChan, 2*time.Second)
+	if !ok {
+		return fmt.Errorf("STORE Timeout")
+	}
+	if resp.Payload.Error != "" {
+		return fmt.Errorf("STORE refused: %s", resp.Payload.Error)
+	}
+	return nil
+}
+
+// valueReply is the answer of a single node to a FIND_VALUE of a lookup
+type valueReply struct {
+	contact Contact
+	resp    RPCMessage
+	ok      bool
+}
+
+// When part of a network with uploaded objects, it must be possible to find and
+// download any object, as long as it is stored by at least one designated node.
+// The value is looked up iteratively: the closest known nodes are asked for it Alpha at a time,
+// and every node that does not hold it answers with the contacts it knows closest to the key,
+// until the value is found or the K closest nodes have all been asked
+func (client *Client) SendFindValueMessage(hash string) (RPCMessage, error) {
+
+	key, err := client.config.KeySpace.Parse(hash)
+	if err != nil {
+		return RPCMessage{}, err
+	}
+
+	// First, check if we have have the value ourself
+	if record, ok := client.node.LookupRecord(key.String()); ok {
+		if record.Tombstone {
+			return RPCMessage{}, ErrDeleted
+		}
+		return *NewRPCMessage("FIND_VALUE", Payload{Key: key.String()}.withRecord(record), false), nil
+	}
+
+	// Start from the closest nodes in the routing table
+	var shortlist []Contact
+	known := map[string]bool{client.node.GetSelfContact().ID.String(): true}
+	learn := func(contacts []Contact) {
+		for _, contact := range contacts {
+			if contact.ID == nil || len(*contact.ID) != len(*key) || known[contact.ID.String()] {
+				continue
+			}
+			known[contact.ID.String()] = true
+			shortlist = append(shortlist, contact)
+		}
+		sort.Slice(shortlist, func(i, j int) bool {
+			return shortlist[i].ID.CalcDistance(key).Less(shortlist[j].ID.CalcDistance(key))
+		})
+	}
+	learn(client.node.LookupClosestContacts(NewContact(key, "")))
+
+	queried := make(map[string]bool)
+	missed := make(map[string]bool) // asked and did not hold the value, the lookup path
+	for {
+		var batch []Contact
+		for _, contact := range shortlist[:min(len(shortlist), client.config.K)] {
+			if !queried[contact.ID.String()] && len(batch) < client.config.Alpha {
+				batch = append(batch, contact)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		replies := make(chan valueReply, len(batch))
+		for _, contact := range batch {
+			queried[contact.ID.String()] = true
+			go func(c Contact) {
+				resp, ok := client.askValue(key.String(), c)
+				replies <- valueReply{contact: c, resp: resp, ok: ok}
+			}(contact)
+		}
+
+		var found *valueReply
+		for range batch {
+			reply := <-replies
+			if !reply.ok {
+				continue // try next contact
+			}
+			if reply.resp.Payload.Tombstone {
+				if err := verifyValue(key.String(), reply.resp.Payload); err == nil {
+					return RPCMessage{}, ErrDeleted
+				}
+			}
+			if reply.resp.Payload.Data != nil {
+				if err := verifyValue(key.String(), reply.resp.Payload); err != nil {
+					log.Printf("FIND_VALUE discarding invalid data from %s: %v\n", reply.contact.String(), err)
+					continue
+				}
+				if found == nil {
+					found = &reply
+				}
+				continue
+			}
+			missed[reply.contact.ID.String()] = true
+			learn(reply.resp.Payload.Contacts)
+		}
+
+		if found != nil {
+			if cacheAt, between, ok := cacheTarget(shortlist, missed); ok {
+				go client.cacheValue(key.String(), recordFromPayload(found.resp.Payload), cacheAt, between)
 			}
-			// else, try next contact
-		case <-time.After(2 * time.Second):
-			log.Println("FIND_VALUE Timeout for contact", contact.String())
-			// try next contact
+			// Found the data, return immediately
+			return found.resp, nil
 		}
 	}
 	// If none of the contacts had the data
 	return RPCMessage{}, fmt.Errorf("FIND_VALUE not found on any contacted node")
 }
+
+// askValue sends a single FIND_VALUE for key to contact and waits for the reply
+func (client *Client) askValue(key string, contact Contact) (RPCMessage, bool) {
+	request := NewRPCMessage("FIND_VALUE", Payload{Key: key}, true)
+	respChan, err := client.SendMessage(contact, request)
+	if err != nil {
+		return RPCMessage{}, false
+	}
+	resp, ok := client.await(contact, respChan, 2*time.Second)
+	if !ok {
+		log.Println("FIND_VALUE Timeout for contact", contact.String())
+	}
+	return resp, ok
+}
@@ -1,7 +1,12 @@
 package kademlia
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +20,9 @@ type MockNodeAPI struct {
 func (m *MockNodeAPI) GetSelfContact() Contact {
 	return Contact{ID: NewKademliaID("0000000000000000000000000000000000000001"), Address: "localhost:" + m.Port}
 }
-func (m *MockNodeAPI) AddContact(contact Contact) {}
+func (m *MockNodeAPI) AddContact(contact Contact)                          {}
+func (m *MockNodeAPI) ContactResponded(contact Contact, rtt time.Duration) {}
+func (m *MockNodeAPI) ContactFailed(contact Contact)                       {}
 func (m *MockNodeAPI) LookupClosestContacts(target Contact) []Contact {
 	return []Contact{m.GetSelfContact()}
 }
@@ -25,11 +32,25 @@ func (m *MockNodeAPI) LookupData(hash string) []byte {
 	}
 	return m.storage[hash]
 }
-func (m *MockNodeAPI) Store(key string, data []byte) {
+func (m *MockNodeAPI) LookupRecord(key string) (Record, bool) {
+	data := m.LookupData(key)
+	return Record{Data: data}, data != nil
+}
+func (m *MockNodeAPI) Store(key string, record Record) error {
 	if m.storage == nil {
 		m.storage = make(map[string][]byte)
 	}
-	m.storage[key] = data
+	m.storage[key] = record.Data
+	return nil
+}
+func (m *MockNodeAPI) MerkleSummary(prefix string) MerkleSummary {
+	return MerkleSummary{Prefix: prefix}
+}
+func (m *MockNodeAPI) AddProvider(key string, contact Contact, ttl time.Duration) error {
+	return nil
+}
+func (m *MockNodeAPI) LookupProviders(key string) []Contact {
+	return nil
 }
 func (m *MockNodeAPI) IterativeFindNode(target *KademliaID) ([]Contact, error) {
 	return []Contact{m.GetSelfContact()}, nil
@@ -113,3 +134,241 @@ func Test_Client_SendFindValueMessage_Timeout_Unreachable(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, RPCMessage{}, resp)
 }
+
+func Test_Client_SendFindValueMessage_InvalidKey(t *testing.T) {
+	port := "20010"
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	client, err := InitClient(&MockNodeAPI{Port: port}, network)
+	assert.NoError(t, err)
+
+	// Keys are parsed instead of being padded or truncated to an ID of some other key
+	for _, hash := range []string{"testhash", "00000007", SHA256KeySpace.Sum([]byte("value")).String()} {
+		_, err := client.SendFindValueMessage(hash)
+		assert.Error(t, err, hash)
+	}
+	_, err = client.SendStoreValueMessage("00000007", Record{Data: []byte("value")}, time.Hour)
+	assert.Error(t, err)
+}
+
+func Test_Client_SendStoreMessage_TTL(t *testing.T) {
+	port := "20007"
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	cfg := defaultConfig()
+	cfg.ValueTTL = time.Hour
+	client, err := newClient(&MockNodeAPI{Port: port}, network, cfg)
+	assert.NoError(t, err)
+
+	// MockNodeAPI points all lookups at its own address, so the STORE ends up there
+	ch := registry.Register("localhost:" + port)
+	go client.SendStoreMessage([]byte("testdata"))
+	select {
+	case pkt := <-ch:
+		var rpc RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &rpc))
+		assert.Equal(t, "STORE", rpc.Type)
+		assert.Equal(t, int64(3600), rpc.Payload.TTL)
+	case <-time.After(1 * time.Second):
+		t.Error("No STORE request sent")
+	}
+}
+
+// respondTo answers every request arriving on ch with the message built by reply
+func respondTo(registry *MockRegistry, ch chan mockPacket, from string, reply func(req RPCMessage) RPCMessage) {
+	go func() {
+		for pkt := range ch {
+			var req RPCMessage
+			if err := json.Unmarshal(pkt.data, &req); err != nil {
+				continue
+			}
+			resp := reply(req)
+			resp.PacketID = req.PacketID
+			data, _ := json.Marshal(resp)
+			if dst, ok := registry.Get(pkt.src); ok {
+				dst <- mockPacket{src: from, data: data}
+			}
+		}
+	}()
+}
+
+func Test_Client_SendFindValueMessage_DiscardsMismatch(t *testing.T) {
+	port := "20008"
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	node := &MockNodeAPI{Port: port}
+	client, err := InitClient(node, network)
+	assert.NoError(t, err)
+
+	peer := "localhost:" + port
+	respondTo(registry, registry.Register(peer), peer, func(req RPCMessage) RPCMessage {
+		return RPCMessage{Type: "FIND_VALUE", Payload: Payload{Data: []byte("poisoned"), SourceContact: node.GetSelfContact()}}
+	})
+
+	key := NewKademliaIDFromData([]byte("value")).String()
+	_, err = client.SendFindValueMessage(key)
+	assert.Error(t, err)
+}
+
+func Test_Client_SendStoreMessage_Refused(t *testing.T) {
+	port := "20009"
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	node := &MockNodeAPI{Port: port}
+	client, err := InitClient(node, network)
+	assert.NoError(t, err)
+
+	peer := "localhost:" + port
+	respondTo(registry, registry.Register(peer), peer, func(req RPCMessage) RPCMessage {
+		return RPCMessage{Type: "STORE", Payload: Payload{Error: "refused", SourceContact: node.GetSelfContact()}}
+	})
+
+	_, err = client.SendStoreMessage([]byte("value"))
+	assert.Error(t, err)
+}
+
+func Test_Client_CacheTTL(t *testing.T) {
+	// At the closest node the copy lives half as long, and half again per node between it and the key
+	assert.Equal(t, 30*time.Minute, cacheTTL(0, time.Hour))
+	assert.Equal(t, 15*time.Minute, cacheTTL(1, time.Hour))
+	assert.Equal(t, 7*time.Minute+30*time.Second, cacheTTL(2, time.Hour))
+	assert.Equal(t, minCacheTTL, cacheTTL(40, time.Hour))
+}
+
+func Test_Client_CacheTarget(t *testing.T) {
+	shortlist := make([]Contact, 5)
+	for i := range shortlist {
+		shortlist[i] = Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, i+1))}
+	}
+
+	// The closest node that missed is picked, whatever its rank
+	missed := map[string]bool{shortlist[1].ID.String(): true, shortlist[3].ID.String(): true}
+	cacheAt, between, ok := cacheTarget(shortlist, missed)
+	assert.True(t, ok)
+	assert.Equal(t, shortlist[1], cacheAt)
+	assert.Equal(t, 1, between)
+
+	_, _, ok = cacheTarget(shortlist, map[string]bool{})
+	assert.False(t, ok)
+}
+
+func Test_Client_SendFindValueMessage_CachesAtClosestMiss(t *testing.T) {
+	nodes := newMockCluster(t, 5300, 6)
+	requester := nodes[5]
+	others := append([]*Kademlia{}, nodes[:5]...)
+
+	// The value is only held by the farthest node, so the lookup asks the closer ones first
+	data := []byte("value found late")
+	key := NewKademliaIDFromData(data)
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Node.Id.CalcDistance(key).Less(others[j].Node.Id.CalcDistance(key))
+	})
+	holder := others[len(others)-1]
+	assert.NoError(t, holder.Node.Store(key.String(), Record{Data: data}))
+
+	resp, err := requester.Client.SendFindValueMessage(key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, data, resp.Payload.Data)
+
+	// The closest node that was asked and missed gets a cached copy living half as long
+	closest := others[0]
+	assert.Eventually(t, func() bool {
+		record, ok := closest.Node.LookupRecord(key.String())
+		return ok && record.Cached
+	}, 3*time.Second, 10*time.Millisecond)
+	record, _ := closest.Node.LookupRecord(key.String())
+	assert.LessOrEqual(t, time.Until(record.ExpiresAt), closest.Node.config.ValueTTL/2)
+	assert.Greater(t, time.Until(record.ExpiresAt), closest.Node.config.ValueTTL/4)
+}
+
+func Test_Client_SendFindValueMessage_CachesOnPath(t *testing.T) {
+	nodes := newMockCluster(t, 5120, 6, WithK(2), WithAlpha(1))
+	bootstrap := nodes[0]
+
+	// Pick a value the bootstrap node is the farthest node from
+	var data []byte
+	var key *KademliaID
+	for i := 0; ; i++ {
+		data = []byte(fmt.Sprintf("popular value %d", i))
+		key = NewKademliaIDFromData(data)
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].Node.Id.CalcDistance(key).Less(nodes[j].Node.Id.CalcDistance(key))
+		})
+		if nodes[len(nodes)-1] == bootstrap {
+			break
+		}
+	}
+	assert.NoError(t, nodes[0].Node.Store(key.String(), Record{Data: data}))
+	assert.NoError(t, nodes[1].Node.Store(key.String(), Record{Data: data}))
+
+	// A requester that only knows the bootstrap node has it on its lookup path
+	registry := bootstrap.Node.config.MockNetworkRegistry
+	requester, err := InitKademlia("5126", false, bootstrap.Node.GetSelfContact().Address,
+		WithSkipBootstrapPing(true), WithK(2), WithAlpha(1), func(cfg *KademliaConfig) {
+			cfg.isMockNetwork = true
+			cfg.MockNetworkRegistry = registry
+		})
+	assert.NoError(t, err)
+	t.Cleanup(requester.Node.Stop)
+
+	resp, err := requester.Client.SendFindValueMessage(key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, data, resp.Payload.Data)
+
+	assert.Eventually(t, func() bool {
+		record, ok := bootstrap.Node.LookupRecord(key.String())
+		return ok && record.Cached
+	}, 3*time.Second, 10*time.Millisecond)
+	record, _ := bootstrap.Node.LookupRecord(key.String())
+	assert.LessOrEqual(t, time.Until(record.ExpiresAt), bootstrap.Node.config.ValueTTL/2)
+
+	// The replicas keep their own copies
+	record, _ = nodes[0].Node.LookupRecord(key.String())
+	assert.False(t, record.Cached)
+}
+
+// MockNodeLiveness records what the Client reports about its contacts
+type MockNodeLiveness struct {
+	MockNodeAPI
+	mu        sync.Mutex
+	responded []Contact
+	failed    []Contact
+}
+
+func (m *MockNodeLiveness) ContactResponded(contact Contact, rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responded = append(m.responded, contact)
+}
+
+func (m *MockNodeLiveness) ContactFailed(contact Contact) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed = append(m.failed, contact)
+}
+
+func Test_Client_ReportsLiveness(t *testing.T) {
+	registry := NewMockRegistry()
+	node := &MockNodeLiveness{MockNodeAPI: MockNodeAPI{Port: "20050"}}
+	client, err := InitClient(node, NewMockNetwork("127.0.0.1:20050", registry))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// The target is reachable but never answers on its own
+	registry.Register("127.0.0.1:20051")
+	target := Contact{ID: NewKademliaID("0000000000000000000000000000000000000002"), Address: "127.0.0.1:20051"}
+	msg := NewRPCMessage("PING", Payload{}, true)
+	respChan, err := client.SendMessage(target, msg)
+	assert.NoError(t, err)
+	respChan <- RPCMessage{Type: "PONG"}
+	_, ok := client.await(target, respChan, time.Second)
+	assert.True(t, ok)
+
+	_, err = client.SendPingMessage(target)
+	assert.Error(t, err)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	assert.Equal(t, []Contact{target}, node.responded)
+	assert.Equal(t, []Contact{target}, node.failed)
+}
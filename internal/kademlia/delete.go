@@ -0,0 +1,166 @@
+package kademlia
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A signed record is deleted by replacing it with a tombstone: a record without data, signed by
+// the publisher's key with a higher sequence number. Nodes keep the tombstone for TombstoneTTL,
+// so replicas, republishing and anti-entropy, which all refuse to go back to an older sequence
+// number, cannot bring the deleted value back.
+//
+// Content addressed values published by a node are owned by its publisher key: they carry the
+// public key and a signature over their key and a sequence number, the time they were published.
+// The owner deletes them with a tombstone signed the same way with a later sequence number. An
+// owned value is never replaced by another publisher's copy of the same content, so only its owner
+// can delete it. Values stored without an owner, e.g. by SendStoreMessage, cannot be deleted
+
+var ErrDeleted = errors.New("value was deleted by its publisher")
+
+// tombstoneSignedBytes returns the bytes signed to delete a mutable record. They can never
+// equal the bytes signed for a value, so a value signature cannot be replayed as a deletion
+func tombstoneSignedBytes(salt []byte, seq int64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("6:deletei1e")
+	if len(salt) > 0 {
+		buf.WriteString("4:salt" + strconv.Itoa(len(salt)) + ":")
+		buf.Write(salt)
+	}
+	buf.WriteString("3:seqi" + strconv.FormatInt(seq, 10) + "e")
+	return buf.Bytes()
+}
+
+// SignTombstone signs the deletion of a mutable record with the publisher's private key
+func SignTombstone(privateKey ed25519.PrivateKey, salt []byte, seq int64) []byte {
+	return ed25519.Sign(privateKey, tombstoneSignedBytes(salt, seq))
+}
+
+// ownedSignedBytes returns the bytes the owner of a content addressed value signs for the value or
+// for its deletion. They start with the key, so they never equal the bytes of a mutable record
+func ownedSignedBytes(key string, seq int64, tombstone bool) []byte {
+	var buf bytes.Buffer
+	if tombstone {
+		buf.WriteString("6:deletei1e")
+	}
+	key = strings.ToLower(key)
+	buf.WriteString("3:key" + strconv.Itoa(len(key)) + ":" + key)
+	buf.WriteString("3:seqi" + strconv.FormatInt(seq, 10) + "e")
+	return buf.Bytes()
+}
+
+// ownedRecord returns data as the value under key owned by privateKey, or the tombstone deleting
+// it when data is nil. The current time is its sequence number, so a deletion is newer than the
+// value and publishing the value again is newer than the deletion
+func ownedRecord(privateKey ed25519.PrivateKey, key string, data []byte) Record {
+	seq := time.Now().UnixNano()
+	return Record{
+		Data:      data,
+		Owner:     privateKey.Public().(ed25519.PublicKey),
+		Seq:       seq,
+		Signature: ed25519.Sign(privateKey, ownedSignedBytes(key, seq, data == nil)),
+		Tombstone: data == nil,
+	}
+}
+
+// verifyOwned checks that an owned content addressed value hashes to key, or is a tombstone
+// without data, and is signed by its owner
+func verifyOwned(key string, payload Payload) error {
+	if len(payload.Owner) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: bad owner key size", ErrInvalidSignature)
+	}
+	if payload.Tombstone {
+		if len(payload.Data) > 0 {
+			return fmt.Errorf("tombstone carries data")
+		}
+	} else if !MatchesData(key, payload.Data) {
+		return fmt.Errorf("data does not match key")
+	}
+	if !ed25519.Verify(payload.Owner, ownedSignedBytes(key, payload.Seq, payload.Tombstone), payload.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// checkOwner decides whether record may replace existing when either of them is owned.
+// keep reports that existing stays without an error: an owned value is not taken over by another
+// publisher's copy of the same content. A value without an owner is never claimed by an owned
+// copy, only the owner deletes a value, never with a tombstone older than the value, and a
+// tombstone keeps every other publisher's copy out until it expires
+func checkOwner(existing Record, record Record) (keep bool, err error) {
+	if len(existing.Owner) == 0 {
+		if len(record.Owner) > 0 {
+			return false, fmt.Errorf("value has no owner and cannot be claimed")
+		}
+		return false, nil
+	}
+	if !bytes.Equal(existing.Owner, record.Owner) {
+		if existing.Tombstone {
+			return false, ErrDeleted
+		}
+		if record.Tombstone {
+			return false, fmt.Errorf("value is owned by another key")
+		}
+		return true, nil
+	}
+	if record.Seq < existing.Seq {
+		return false, fmt.Errorf("%w: have %d, got %d", ErrStaleSequence, existing.Seq, record.Seq)
+	}
+	return false, nil
+}
+
+// DeleteContent deletes the content addressed value under key that this node published, by storing
+// a tombstone signed with its publisher key at the nodes closest to key. The node's own publisher
+// copy is replaced by the tombstone as well
+func (node *Node) DeleteContent(key string) error {
+	keyID, err := node.config.KeySpace.Parse(key)
+	if err != nil {
+		return err
+	}
+	key = keyID.String()
+	record := ownedRecord(node.config.PublisherKey, key, nil)
+	ttl := node.config.TombstoneTTL
+	if _, err := node.Client.SendDeleteMessage(key, record, ttl); err != nil {
+		return err
+	}
+
+	record.Source = node.GetSelfContact()
+	record.ExpiresAt = time.Now().Add(ttl)
+	if err := node.Store(key, record); err != nil {
+		log.Printf("failed to keep tombstone %s: %v\n", key, err)
+	}
+	return nil
+}
+
+// DeleteMutable deletes the mutable record of privateKey and salt by sending a tombstone with
+// sequence number seq, which must be higher than that of the stored record, to the nodes closest
+// to its key. The node's own publisher copy is replaced by the tombstone as well
+func (client *Client) DeleteMutable(privateKey ed25519.PrivateKey, salt []byte, seq int64) (string, error) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	key := client.config.KeySpace.MutableKey(publicKey, salt).String()
+	record := Record{
+		PublicKey: publicKey,
+		Salt:      salt,
+		Seq:       seq,
+		Signature: SignTombstone(privateKey, salt, seq),
+		Tombstone: true,
+	}
+
+	ttl := client.config.TombstoneTTL
+	if _, err := client.SendDeleteMessage(key, record, ttl); err != nil {
+		return "", err
+	}
+
+	record.Source = client.node.GetSelfContact()
+	record.ExpiresAt = time.Now().Add(ttl)
+	if err := client.node.Store(key, record); err != nil {
+		log.Printf("failed to keep tombstone %s: %v\n", key, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,206 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tombstonePayload(privateKey ed25519.PrivateKey, salt []byte, seq int64) Payload {
+	return Payload{
+		PublicKey: privateKey.Public().(ed25519.PublicKey),
+		Salt:      salt,
+		Seq:       seq,
+		Signature: SignTombstone(privateKey, salt, seq),
+		Tombstone: true,
+	}
+}
+
+func Test_Delete_verifyTombstone(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	key := MutableKey(publicKey, nil).String()
+
+	assert.NoError(t, verifyValue(key, tombstonePayload(privateKey, nil, 2)))
+
+	// A value signature cannot be replayed as a deletion
+	replayed := signedPayload(privateKey, nil, 2, nil)
+	replayed.Tombstone = true
+	assert.ErrorIs(t, verifyValue(key, replayed), ErrInvalidSignature)
+
+	withData := tombstonePayload(privateKey, nil, 2)
+	withData.Data = []byte("value")
+	assert.Error(t, verifyValue(key, withData))
+
+	// Someone else's key cannot delete the record
+	_, otherKey := newTestKey(t)
+	forged := tombstonePayload(otherKey, nil, 2)
+	forged.PublicKey = publicKey
+	assert.ErrorIs(t, verifyValue(key, forged), ErrInvalidSignature)
+
+	// Content addressed values have no publisher key to authorize a deletion
+	contentKey := NewKademliaIDFromData([]byte("value")).String()
+	assert.Error(t, verifyValue(contentKey, Payload{Tombstone: true}))
+}
+
+func Test_Delete_Node_TombstonePreventsResurrection(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	publicKey, privateKey := newTestKey(t)
+	key := MutableKey(publicKey, nil).String()
+
+	assert.NoError(t, node.Store(key, recordFromPayload(signedPayload(privateKey, nil, 1, []byte("value")))))
+	assert.NoError(t, node.Store(key, recordFromPayload(tombstonePayload(privateKey, nil, 2))))
+
+	record, ok := node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.True(t, record.Tombstone)
+	assert.Nil(t, node.LookupData(key))
+
+	// Republishing or replicating the old value does not bring it back
+	assert.ErrorIs(t, node.Store(key, recordFromPayload(signedPayload(privateKey, nil, 1, []byte("value")))), ErrStaleSequence)
+	assert.ErrorIs(t, node.Store(key, recordFromPayload(signedPayload(privateKey, nil, 2, []byte("value")))), ErrStaleSequence)
+
+	// The publisher can store a new value after the deletion
+	assert.NoError(t, node.Store(key, recordFromPayload(signedPayload(privateKey, nil, 3, []byte("new")))))
+}
+
+func Test_Delete_DeleteMutable(t *testing.T) {
+	nodes := newMockCluster(t, 5170, 4)
+	publicKey, privateKey := newTestKey(t)
+
+	key, err := nodes[1].Client.PutMutable(privateKey, nil, 1, []byte("mistake"))
+	assert.NoError(t, err)
+
+	deleted, err := nodes[1].Client.DeleteMutable(privateKey, nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, key, deleted)
+
+	_, err = nodes[3].Client.GetMutable(publicKey, nil)
+	assert.ErrorIs(t, err, ErrDeleted)
+	_, err = nodes[3].Client.SendFindValueMessage(key)
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	// The publisher no longer republishes the value, and a stale put is refused
+	local, ok := nodes[1].Node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.True(t, local.Tombstone)
+	assert.False(t, local.Publisher)
+	assert.Equal(t, 0, nodes[1].Node.Republish())
+	_, err = nodes[2].Client.PutMutable(privateKey, nil, 1, []byte("mistake"))
+	assert.Error(t, err)
+}
+
+func Test_Delete_verifyOwned(t *testing.T) {
+	_, privateKey := newTestKey(t)
+	_, otherKey := newTestKey(t)
+	data := []byte("owned")
+	key := NewKademliaIDFromData(data).String()
+
+	record := ownedRecord(privateKey, key, data)
+	assert.NoError(t, verifyValue(key, Payload{}.withRecord(record)))
+	tombstone := ownedRecord(privateKey, key, nil)
+	assert.NoError(t, verifyValue(key, Payload{}.withRecord(tombstone)))
+
+	// Data of another key, a value signature used as a deletion or a signature by another key are refused
+	assert.Error(t, verifyValue(NewKademliaIDFromData([]byte("other")).String(), Payload{}.withRecord(record)))
+	forged := record
+	forged.Data = nil
+	forged.Tombstone = true
+	assert.ErrorIs(t, verifyValue(key, Payload{}.withRecord(forged)), ErrInvalidSignature)
+	forged = ownedRecord(otherKey, key, nil)
+	forged.Owner = record.Owner
+	assert.ErrorIs(t, verifyValue(key, Payload{}.withRecord(forged)), ErrInvalidSignature)
+}
+
+func Test_Delete_Node_Store_Owned(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	_, privateKey := newTestKey(t)
+	_, otherKey := newTestKey(t)
+	data := []byte("owned")
+	key := NewKademliaIDFromData(data).String()
+
+	// A value stored without an owner cannot be claimed, and so cannot be deleted either
+	unowned := NewKademliaIDFromData([]byte("unowned")).String()
+	assert.NoError(t, node.Store(unowned, Record{Data: []byte("unowned")}))
+	assert.Error(t, node.Store(unowned, ownedRecord(otherKey, unowned, []byte("unowned"))))
+	assert.Error(t, node.Store(unowned, ownedRecord(otherKey, unowned, nil)))
+	assert.Equal(t, []byte("unowned"), node.LookupData(unowned))
+
+	// An owned value is not taken over by another publisher, and only its owner deletes it
+	value := ownedRecord(privateKey, key, data)
+	assert.NoError(t, node.Store(key, value))
+	assert.NoError(t, node.Store(key, ownedRecord(otherKey, key, data)))
+	assert.NoError(t, node.Store(key, Record{Data: data}))
+	record, _ := node.LookupRecord(key)
+	assert.Equal(t, value.Owner, record.Owner)
+	assert.Error(t, node.Store(key, ownedRecord(otherKey, key, nil)))
+
+	// The tombstone keeps the content out, whoever stores it again
+	tombstone := ownedRecord(privateKey, key, nil)
+	tombstone.ExpiresAt = time.Now().Add(time.Hour)
+	assert.NoError(t, node.Store(key, tombstone))
+	assert.Nil(t, node.LookupData(key))
+	assert.ErrorIs(t, node.Store(key, value), ErrStaleSequence)
+	assert.ErrorIs(t, node.Store(key, ownedRecord(otherKey, key, data)), ErrDeleted)
+	assert.ErrorIs(t, node.Store(key, Record{Data: data}), ErrDeleted)
+	assert.Nil(t, node.LookupData(key))
+
+	// Its owner publishing the content again after the deletion brings it back
+	assert.NoError(t, node.Store(key, ownedRecord(privateKey, key, data)))
+	assert.Equal(t, data, node.LookupData(key))
+
+	// Once the tombstone expired, anyone may store the content again
+	tombstone = ownedRecord(privateKey, key, nil)
+	tombstone.ExpiresAt = time.Now().Add(-time.Second)
+	assert.NoError(t, node.Storage.Put(key, tombstone))
+	assert.NoError(t, node.Store(key, ownedRecord(otherKey, key, data)))
+	assert.Equal(t, data, node.LookupData(key))
+}
+
+func Test_Delete_DeleteContent(t *testing.T) {
+	nodes := newMockCluster(t, 5250, 4)
+
+	stored, err := nodes[1].Node.Put("uploaded by mistake")
+	assert.NoError(t, err)
+	key := NewKademliaIDFromData([]byte("uploaded by mistake")).String()
+	assert.Contains(t, stored, key)
+
+	deleted, err := nodes[1].Node.Delete(key)
+	assert.NoError(t, err)
+	assert.Contains(t, deleted, "Content deleted!")
+	_, err = nodes[3].Client.SendFindValueMessage(key)
+	assert.ErrorIs(t, err, ErrDeleted)
+	assert.Equal(t, 0, nodes[1].Node.Republish())
+
+	// Another node cannot delete a value it did not publish
+	_, err = nodes[1].Node.Put("kept")
+	assert.NoError(t, err)
+	key = NewKademliaIDFromData([]byte("kept")).String()
+	assert.Error(t, nodes[2].Node.DeleteContent(key))
+	_, err = nodes[3].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+}
+
+func Test_Delete_Republish_DropsSuperseded(t *testing.T) {
+	nodes := newMockCluster(t, 5260, 4)
+	publicKey, privateKey := newTestKey(t)
+
+	key, err := nodes[1].Client.PutMutable(privateKey, nil, 1, []byte("mistake"))
+	assert.NoError(t, err)
+
+	// The deletion reached every node but the publisher, as when it is sent from a node
+	// that does not count the publisher among the closest nodes of the key
+	tombstone := recordFromPayload(tombstonePayload(privateKey, nil, 2))
+	for _, node := range []*Kademlia{nodes[0], nodes[2], nodes[3]} {
+		assert.NoError(t, node.Node.Store(key, tombstone))
+	}
+
+	// The publisher stops republishing the old value instead of bringing it back later
+	assert.Equal(t, 0, nodes[1].Node.Republish())
+	_, ok := nodes[1].Node.LookupRecord(key)
+	assert.False(t, ok)
+	assert.Equal(t, 0, nodes[1].Node.Republish())
+	_, err = nodes[3].Client.GetMutable(publicKey, nil)
+	assert.ErrorIs(t, err, ErrDeleted)
+}
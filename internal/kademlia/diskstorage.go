@@ -0,0 +1,421 @@
+package kademlia
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	diskLogName            = "values.log"
+	diskCompactName        = "values.log.compact"
+	diskHeaderSize         = 13 // crc32 (4) + op (1) + key length (4) + value length (4)
+	diskValueHeaderSize    = 4  // length of the JSON encoded record metadata preceding the data
+	diskCompactionInterval = 10 * time.Minute
+	diskCompactionMinBytes = 1 << 20
+)
+
+const (
+	diskOpPut    byte = 1
+	diskOpDelete byte = 2
+)
+
+var ErrReadOnlyStorage = errors.New("storage is opened read-only")
+
+// diskEntry locates the encoded value of a live key inside the log file
+type diskEntry struct {
+	offset   int64
+	size     int
+	dataSize int
+}
+
+// DiskStorage is a Storage that keeps values in an append-only log file on disk.
+// An in-memory index maps every live key to its latest record in the log.
+// Overwritten and deleted records are reclaimed by periodic compaction, and a
+// torn record at the tail of the log (e.g. after a crash) is truncated on open
+type DiskStorage struct {
+	dir       string
+	file      *os.File
+	index     map[string]diskEntry
+	size      int64 // total bytes in the log
+	liveBytes int64 // bytes of records still referenced by the index
+	readOnly  bool
+	mu        sync.RWMutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDiskStorage opens (or creates) the log in dir, rebuilds the index from it
+// and starts the background compaction loop
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	// A leftover compaction file means we crashed mid-compaction, the original log is still intact
+	_ = os.Remove(filepath.Join(dir, diskCompactName))
+
+	file, err := os.OpenFile(filepath.Join(dir, diskLogName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage log: %w", err)
+	}
+
+	s := &DiskStorage{
+		dir:   dir,
+		file:  file,
+		index: make(map[string]diskEntry),
+		done:  make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	go s.compactLoop()
+
+	return s, nil
+}
+
+// OpenDiskStorageReadOnly opens the log in dir for reading only, e.g. to export the values of a
+// node that may still be running. Unlike NewDiskStorage it never modifies dir: a compaction file
+// is left alone, a torn tail is skipped instead of truncated and the log is never compacted.
+// Put and Delete return ErrReadOnlyStorage
+func OpenDiskStorageReadOnly(dir string) (*DiskStorage, error) {
+	file, err := os.Open(filepath.Join(dir, diskLogName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage log: %w", err)
+	}
+
+	s := &DiskStorage{
+		dir:      dir,
+		file:     file,
+		index:    make(map[string]diskEntry),
+		readOnly: true,
+		done:     make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover replays the log to rebuild the index, truncating any corrupt tail unless read-only
+func (s *DiskStorage) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat storage log: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for {
+		op, key, data, n, err := readDiskRecord(reader, info.Size()-offset)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !s.readOnly {
+				log.Printf("storage log %s: truncating corrupt tail at offset %d: %v\n", s.dir, offset, err)
+			}
+			break
+		}
+		s.apply(op, key, offset, n, data)
+		offset += n
+	}
+
+	if s.readOnly {
+		s.size = offset
+		return nil
+	}
+	if err := s.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate storage log: %w", err)
+	}
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	s.size = offset
+	return nil
+}
+
+// apply updates the index for a record of n bytes holding value written at offset
+func (s *DiskStorage) apply(op byte, key string, offset int64, n int64, value []byte) {
+	if old, ok := s.index[key]; ok {
+		s.liveBytes -= diskHeaderSize + int64(len(key)+old.size)
+	}
+	switch op {
+	case diskOpPut:
+		metaLen := int(binary.BigEndian.Uint32(value[0:diskValueHeaderSize]))
+		s.index[key] = diskEntry{
+			offset:   offset + n - int64(len(value)),
+			size:     len(value),
+			dataSize: len(value) - diskValueHeaderSize - metaLen,
+		}
+		s.liveBytes += n
+	case diskOpDelete:
+		delete(s.index, key)
+	}
+}
+
+// encodeDiskValue prefixes the data with the JSON encoded metadata of the record
+func encodeDiskValue(record Record) []byte {
+	data := record.Data
+	record.Data = nil
+	meta, _ := json.Marshal(record)
+	buf := make([]byte, diskValueHeaderSize+len(meta)+len(data))
+	binary.BigEndian.PutUint32(buf[0:diskValueHeaderSize], uint32(len(meta)))
+	copy(buf[diskValueHeaderSize:], meta)
+	copy(buf[diskValueHeaderSize+len(meta):], data)
+	return buf
+}
+
+func decodeDiskValue(buf []byte) (Record, error) {
+	var record Record
+	metaLen := int(binary.BigEndian.Uint32(buf[0:diskValueHeaderSize]))
+	if err := json.Unmarshal(buf[diskValueHeaderSize:diskValueHeaderSize+metaLen], &record); err != nil {
+		return Record{}, fmt.Errorf("corrupt record metadata: %w", err)
+	}
+	record.Data = buf[diskValueHeaderSize+metaLen:]
+	return record, nil
+}
+
+func encodeDiskRecord(op byte, key string, data []byte) []byte {
+	buf := make([]byte, diskHeaderSize+len(key)+len(data))
+	buf[4] = op
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(data)))
+	copy(buf[diskHeaderSize:], key)
+	copy(buf[diskHeaderSize+len(key):], data)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// readDiskRecord reads one record from the remaining bytes of the log, returning io.EOF only on
+// a clean end of log. A record claiming to be longer than what is left is torn and never allocated
+func readDiskRecord(r io.Reader, remaining int64) (op byte, key string, data []byte, n int64, err error) {
+	header := make([]byte, diskHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("torn record header")
+		}
+		return
+	}
+	op = header[4]
+	keyLen := binary.BigEndian.Uint32(header[5:9])
+	dataLen := binary.BigEndian.Uint32(header[9:13])
+	if op != diskOpPut && op != diskOpDelete {
+		err = fmt.Errorf("unknown record type %d", op)
+		return
+	}
+	if op == diskOpPut && dataLen < diskValueHeaderSize {
+		err = fmt.Errorf("value too short")
+		return
+	}
+
+	bodyLen := int64(keyLen) + int64(dataLen)
+	if bodyLen > remaining-diskHeaderSize {
+		err = fmt.Errorf("torn record body: %d bytes claimed, %d left", bodyLen, remaining-diskHeaderSize)
+		return
+	}
+
+	body := make([]byte, bodyLen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = fmt.Errorf("torn record body: %w", err)
+		return
+	}
+	if crc32.ChecksumIEEE(append(header[4:], body...)) != binary.BigEndian.Uint32(header[0:4]) {
+		err = fmt.Errorf("checksum mismatch")
+		return
+	}
+	key = string(body[:keyLen])
+	data = body[keyLen:]
+	if op == diskOpPut && int(binary.BigEndian.Uint32(data[0:diskValueHeaderSize])) > len(data)-diskValueHeaderSize {
+		err = fmt.Errorf("metadata length out of range")
+		return
+	}
+	n = int64(diskHeaderSize) + int64(len(body))
+	return
+}
+
+// appendRecord writes a record to the end of the log and syncs it, callers must hold s.mu
+func (s *DiskStorage) appendRecord(op byte, key string, data []byte) error {
+	if s.readOnly {
+		return ErrReadOnlyStorage
+	}
+	buf := encodeDiskRecord(op, key, data)
+	if _, err := s.file.WriteAt(buf, s.size); err != nil {
+		return fmt.Errorf("failed to write storage log: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync storage log: %w", err)
+	}
+	s.apply(op, key, s.size, int64(len(buf)), data)
+	s.size += int64(len(buf))
+	return nil
+}
+
+func (s *DiskStorage) Put(key string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendRecord(diskOpPut, key, encodeDiskValue(record))
+}
+
+func (s *DiskStorage) Get(key string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.index[key]
+	if !ok {
+		return Record{}, false
+	}
+	buf := make([]byte, entry.size)
+	if _, err := s.file.ReadAt(buf, entry.offset); err != nil {
+		log.Printf("storage log %s: failed to read %s: %v\n", s.dir, key, err)
+		return Record{}, false
+	}
+	record, err := decodeDiskValue(buf)
+	if err != nil {
+		log.Printf("storage log %s: failed to decode %s: %v\n", s.dir, key, err)
+		return Record{}, false
+	}
+	return record, true
+}
+
+func (s *DiskStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	return s.appendRecord(diskOpDelete, key, nil)
+}
+
+// ForEach iterates over a snapshot of the live keys so fn may call back into the storage
+func (s *DiskStorage) ForEach(fn func(key string, record Record) bool) {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	for _, key := range keys {
+		record, ok := s.Get(key)
+		if !ok {
+			continue
+		}
+		if !fn(key, record) {
+			return
+		}
+	}
+}
+
+func (s *DiskStorage) Stats() StorageStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := StorageStats{Keys: len(s.index)}
+	for _, entry := range s.index {
+		stats.Bytes += entry.dataSize
+	}
+	return stats
+}
+
+// Compact rewrites the log so that it only contains the live records
+func (s *DiskStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readOnly {
+		return ErrReadOnlyStorage
+	}
+
+	tmpPath := filepath.Join(s.dir, diskCompactName)
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create compaction file: %w", err)
+	}
+
+	index := make(map[string]diskEntry, len(s.index))
+	writer := bufio.NewWriter(tmp)
+	var offset int64
+	for key, entry := range s.index {
+		data := make([]byte, entry.size)
+		if _, err := s.file.ReadAt(data, entry.offset); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to read %s during compaction: %w", key, err)
+		}
+		buf := encodeDiskRecord(diskOpPut, key, data)
+		if _, err := writer.Write(buf); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to write compaction file: %w", err)
+		}
+		offset += int64(len(buf))
+		entry.offset = offset - int64(len(data))
+		index[key] = entry
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to flush compaction file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, diskLogName)); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace storage log: %w", err)
+	}
+	s.file.Close()
+	s.file = tmp
+	s.index = index
+	s.size = offset
+	s.liveBytes = offset
+	return nil
+}
+
+// needsCompaction reports whether more than half of the log is garbage
+func (s *DiskStorage) needsCompaction() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size >= diskCompactionMinBytes && s.size-s.liveBytes > s.liveBytes
+}
+
+func (s *DiskStorage) compactLoop() {
+	ticker := time.NewTicker(diskCompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if !s.needsCompaction() {
+				continue
+			}
+			if err := s.Compact(); err != nil {
+				log.Printf("storage log %s: compaction failed: %v\n", s.dir, err)
+			}
+		}
+	}
+}
+
+// Close stops the compaction loop and closes the log file
+func (s *DiskStorage) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err = s.file.Close()
+	})
+	return err
+}
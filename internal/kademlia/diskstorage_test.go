@@ -0,0 +1,201 @@
+package kademlia
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiskStorage_PutGetDelete(t *testing.T) {
+	s, err := NewDiskStorage(t.TempDir())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Put("key", Record{Data: []byte("value")}))
+	record, ok := s.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), record.Data)
+
+	assert.NoError(t, s.Put("key", Record{Data: []byte("newer")}))
+	record, _ = s.Get("key")
+	assert.Equal(t, []byte("newer"), record.Data)
+
+	assert.NoError(t, s.Delete("key"))
+	_, ok = s.Get("key")
+	assert.False(t, ok)
+	assert.Equal(t, StorageStats{}, s.Stats())
+}
+
+func Test_DiskStorage_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	s.Put("a", Record{Data: []byte("1")})
+	s.Put("b", Record{Data: []byte("2")})
+	s.Delete("a")
+	s.Close()
+
+	s, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	_, ok := s.Get("a")
+	assert.False(t, ok)
+	record, ok := s.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), record.Data)
+}
+
+func Test_DiskStorage_RecoverTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	s.Put("a", Record{Data: []byte("1")})
+	s.Close()
+
+	// Simulate a crash in the middle of writing a second record
+	path := filepath.Join(dir, diskLogName)
+	torn := encodeDiskRecord(diskOpPut, "b", encodeDiskValue(Record{Data: []byte("2")}))
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+
+	s, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	record, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), record.Data)
+	_, ok = s.Get("b")
+	assert.False(t, ok)
+
+	// New writes land after the truncated tail and survive a reopen
+	assert.NoError(t, s.Put("c", Record{Data: []byte("3")}))
+	record, ok = s.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), record.Data)
+}
+
+func Test_DiskStorage_RecoverOversizedTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	s.Put("a", Record{Data: []byte("1")})
+	s.Close()
+	path := filepath.Join(dir, diskLogName)
+	info, _ := os.Stat(path)
+
+	// A garbage header claiming a huge record is treated as a torn tail, not allocated
+	header := make([]byte, diskHeaderSize)
+	header[4] = diskOpPut
+	binary.BigEndian.PutUint32(header[5:9], 0xffffffff)
+	binary.BigEndian.PutUint32(header[9:13], 0xffffffff)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.Write(header)
+	f.Close()
+
+	s, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	record, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), record.Data)
+	truncated, _ := os.Stat(path)
+	assert.Equal(t, info.Size(), truncated.Size())
+}
+
+func Test_DiskStorage_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer writer.Close()
+	writer.Put("a", Record{Data: []byte("1")})
+
+	// A record still being written and a compaction in progress look like a torn tail
+	// and a leftover compaction file, neither of which a reader may touch
+	path := filepath.Join(dir, diskLogName)
+	torn := encodeDiskRecord(diskOpPut, "b", encodeDiskValue(Record{Data: []byte("2")}))
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+	before, _ := os.Stat(path)
+	compactPath := filepath.Join(dir, diskCompactName)
+	assert.NoError(t, os.WriteFile(compactPath, []byte("in progress"), 0o644))
+
+	s, err := OpenDiskStorageReadOnly(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	record, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), record.Data)
+	assert.Equal(t, 1, s.Stats().Keys)
+
+	after, _ := os.Stat(path)
+	assert.Equal(t, before.Size(), after.Size())
+	assert.FileExists(t, compactPath)
+
+	assert.ErrorIs(t, s.Put("c", Record{Data: []byte("3")}), ErrReadOnlyStorage)
+	assert.ErrorIs(t, s.Delete("a"), ErrReadOnlyStorage)
+	assert.ErrorIs(t, s.Compact(), ErrReadOnlyStorage)
+
+	_, err = OpenDiskStorageReadOnly(t.TempDir())
+	assert.Error(t, err)
+}
+
+func Test_DiskStorage_Compact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	for range 10 {
+		s.Put("a", Record{Data: []byte("overwritten")})
+	}
+	s.Put("b", Record{Data: []byte("kept")})
+	s.Delete("b")
+	s.Put("c", Record{Data: []byte("live")})
+
+	before, _ := os.Stat(filepath.Join(dir, diskLogName))
+	assert.NoError(t, s.Compact())
+	after, _ := os.Stat(filepath.Join(dir, diskLogName))
+	assert.Less(t, after.Size(), before.Size())
+
+	record, _ := s.Get("a")
+	assert.Equal(t, []byte("overwritten"), record.Data)
+	_, ok := s.Get("b")
+	assert.False(t, ok)
+	s.Close()
+
+	s, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, s.Stats().Keys)
+	record, _ = s.Get("c")
+	assert.Equal(t, []byte("live"), record.Data)
+}
+
+func Test_DiskStorage_RecordTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	storedAt := time.Now()
+	expiresAt := storedAt.Add(time.Hour)
+	s.Put("ttl", Record{Data: []byte("x"), StoredAt: storedAt, ExpiresAt: expiresAt})
+	source := NewContact(NewKademliaID("1111111111111111111111111111111111111111"), "127.0.0.1:9000")
+	s.Put("forever", Record{Data: []byte("y"), Publisher: true, Source: source})
+	s.Close()
+
+	s, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer s.Close()
+	record, _ := s.Get("ttl")
+	assert.True(t, record.StoredAt.Equal(storedAt))
+	assert.True(t, record.ExpiresAt.Equal(expiresAt))
+	assert.False(t, record.Publisher)
+	record, _ = s.Get("forever")
+	assert.True(t, record.ExpiresAt.IsZero())
+	assert.True(t, record.Publisher)
+	assert.Equal(t, source, record.Source)
+	assert.Equal(t, StorageStats{Keys: 2, Bytes: 2}, s.Stats())
+}
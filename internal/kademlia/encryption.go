@@ -0,0 +1,118 @@
+package kademlia
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Encrypted values are sealed with AES-256-GCM before they leave the node, so the nodes storing
+// them only ever see ciphertext. The ciphertext is stored like any other value under its hash,
+// and the read capability handed back to the caller holds that key and the AES key.
+// With convergent encryption the AES key is derived from the plaintext, so identical content
+// encrypts to identical ciphertext and is stored once. The price is that anyone who can guess the
+// plaintext can confirm that it is stored
+
+const encryptionKeySize = 32
+
+// PutEncrypted encrypts data and stores the ciphertext, returning its storage key and the read
+// capability needed to decrypt it. The node keeps a copy as its publisher so it is republished
+func (client *Client) PutEncrypted(data []byte, convergent bool) (string, string, error) {
+	var aesKey []byte
+	if convergent {
+		sum := sha256.Sum256(data)
+		aesKey = sum[:]
+	} else {
+		aesKey = make([]byte, encryptionKeySize)
+		if _, err := rand.Read(aesKey); err != nil {
+			return "", "", fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+
+	ciphertext, err := sealValue(aesKey, data, convergent)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := client.SendStoreMessage(ciphertext); err != nil {
+		return "", "", err
+	}
+
+	key := client.config.KeySpace.Sum(ciphertext).String()
+	keepPublished(client.node, key, Record{Data: ciphertext})
+	return key, key + ":" + hex.EncodeToString(aesKey), nil
+}
+
+// GetEncrypted fetches the value a read capability refers to and decrypts it
+func (client *Client) GetEncrypted(capability string) ([]byte, error) {
+	key, aesKey, err := parseCapability(client.config.KeySpace, capability)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.SendFindValueMessage(key)
+	if err != nil {
+		return nil, err
+	}
+	return openValue(aesKey, resp.Payload.Data)
+}
+
+// parseCapability splits a read capability into the storage key, which must belong to keySpace, and the AES key
+func parseCapability(keySpace KeySpace, capability string) (string, []byte, error) {
+	key, encoded, ok := strings.Cut(capability, ":")
+	if !ok {
+		return "", nil, fmt.Errorf("malformed read capability")
+	}
+	if _, err := keySpace.Parse(key); err != nil {
+		return "", nil, fmt.Errorf("malformed read capability: %w", err)
+	}
+	aesKey, err := hex.DecodeString(encoded)
+	if err != nil || len(aesKey) != encryptionKeySize {
+		return "", nil, fmt.Errorf("malformed read capability key")
+	}
+	return key, aesKey, nil
+}
+
+// sealValue encrypts data, prefixing the ciphertext with its nonce. Convergent encryption uses
+// a nonce derived from the key, which is safe since that key is only ever used for this plaintext
+func sealValue(aesKey []byte, data []byte, convergent bool) ([]byte, error) {
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if convergent {
+		sum := sha256.Sum256(append([]byte("nonce"), aesKey...))
+		copy(nonce, sum[:])
+	} else if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// openValue decrypts a value sealed by sealValue
+func openValue(aesKey []byte, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return data, nil
+}
+
+func newGCM(aesKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
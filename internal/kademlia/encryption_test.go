@@ -0,0 +1,93 @@
+package kademlia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Encryption_SealOpen(t *testing.T) {
+	aesKey := bytes.Repeat([]byte{7}, encryptionKeySize)
+	data := []byte("secret value")
+
+	sealed, err := sealValue(aesKey, data, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	opened, err := openValue(aesKey, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	again, _ := sealValue(aesKey, data, false)
+	assert.NotEqual(t, sealed, again)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = openValue(aesKey, sealed)
+	assert.Error(t, err)
+}
+
+func Test_Encryption_Convergent(t *testing.T) {
+	aesKey := bytes.Repeat([]byte{7}, encryptionKeySize)
+	first, _ := sealValue(aesKey, []byte("same"), true)
+	second, _ := sealValue(aesKey, []byte("same"), true)
+	assert.Equal(t, first, second)
+}
+
+func Test_Encryption_parseCapability(t *testing.T) {
+	key := NewKademliaIDFromData([]byte("value")).String()
+	aesKey := bytes.Repeat([]byte{1}, encryptionKeySize)
+
+	parsedKey, parsedAESKey, err := parseCapability(SHA1KeySpace, key+":"+hex.EncodeToString(aesKey))
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsedKey)
+	assert.Equal(t, aesKey, parsedAESKey)
+
+	// A key of another key space is as malformed as one that is not hex
+	wide := SHA256KeySpace.Sum([]byte("value")).String() + ":" + hex.EncodeToString(aesKey)
+	for _, capability := range []string{key, "zz:" + key, key + ":0101", key + ":nothex", wide} {
+		_, _, err := parseCapability(SHA1KeySpace, capability)
+		assert.Error(t, err, capability)
+	}
+}
+
+func Test_Encryption_PutGet(t *testing.T) {
+	nodes := newMockCluster(t, 5180, 3)
+	data := []byte("nobody else can read this")
+
+	key, capability, err := nodes[1].Client.PutEncrypted(data, false)
+	assert.NoError(t, err)
+	assert.Contains(t, capability, key)
+
+	// Nodes holding the value only see ciphertext
+	for _, node := range nodes {
+		if stored := node.Node.LookupData(key); stored != nil {
+			assert.NotContains(t, string(stored), "nobody")
+		}
+	}
+
+	result, err := nodes[2].Client.GetEncrypted(capability)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+
+	// The storage key alone is not enough to read the value
+	_, err = nodes[2].Client.GetEncrypted(key)
+	assert.Error(t, err)
+}
+
+func Test_Encryption_PutConvergent_Deduplicates(t *testing.T) {
+	nodes := newMockCluster(t, 5190, 3)
+	data := []byte("shared document")
+
+	first, firstCapability, err := nodes[1].Client.PutEncrypted(data, true)
+	assert.NoError(t, err)
+	second, secondCapability, err := nodes[2].Client.PutEncrypted(data, true)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, firstCapability, secondCapability)
+
+	other, _, err := nodes[2].Client.PutEncrypted(data, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
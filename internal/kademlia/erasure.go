@@ -0,0 +1,154 @@
+package kademlia
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const erasureKind = "erasure"
+
+// ErasureManifest describes a value stored as n Reed-Solomon shards, any DataShards of which
+// reconstruct it. Every shard is stored under the hash of its index followed by its bytes,
+// so each shard lands at its own set of closest nodes
+type ErasureManifest struct {
+	Kind       string   `json:"kind"`
+	Size       int      `json:"size"`
+	DataShards int      `json:"data_shards"`
+	Shards     []string `json:"shards"`
+}
+
+// PutErasure splits data into n shards of which any m reconstruct it, stores every shard at the
+// ShardReplicas closest nodes of its key and publishes a manifest listing them, and returns the key
+// of the manifest. The network holds ShardReplicas·n/m times the data instead of k copies of it,
+// trading lookup work for storage. Shards are republished by this node to the same number of
+// nodes and never replicated to the k closest
+func (node *Node) PutErasure(data []byte, n int, m int) (string, error) {
+	shards, err := erasureEncode(data, n, m)
+	if err != nil {
+		return "", err
+	}
+	if len(shards[0])+1 > chunkSize {
+		return "", fmt.Errorf("shards of %d bytes exceed %d bytes, use more data shards or PutLarge", len(shards[0])+1, chunkSize)
+	}
+
+	manifest := ErasureManifest{Kind: erasureKind, Size: len(data), DataShards: m, Shards: make([]string, n)}
+	values := make([][]byte, n)
+	for i, shard := range shards {
+		values[i] = append([]byte{byte(i)}, shard...)
+		manifest.Shards[i] = node.config.KeySpace.Sum(values[i]).String()
+	}
+
+	err = forEachParallel(n, func(i int) error {
+		key := manifest.Shards[i]
+		record := ownedRecord(node.config.PublisherKey, key, values[i])
+		record.Shard = true
+		if _, err := node.storeShard(key, record, node.config.ValueTTL); err != nil {
+			return fmt.Errorf("failed to store shard %d: %w", i, err)
+		}
+		keepPublished(node, key, record)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if len(encoded) > chunkSize {
+		return "", fmt.Errorf("manifest of %d shards is too large", n)
+	}
+	if _, err := node.Publish(encoded); err != nil {
+		return "", fmt.Errorf("failed to store manifest: %w", err)
+	}
+	return node.config.KeySpace.Sum(encoded).String(), nil
+}
+
+// storeShard stores the erasure shard record at the ShardReplicas closest other nodes of key and
+// returns how many accepted it
+func (node *Node) storeShard(key string, record Record, ttl time.Duration) (int, error) {
+	keyID, err := node.config.KeySpace.Parse(key)
+	if err != nil {
+		return 0, err
+	}
+	closest, err := node.IterativeFindNode(keyID)
+	if err != nil {
+		return 0, err
+	}
+	self := node.GetSelfContact()
+	stored := 0
+	for _, contact := range closest {
+		if stored == node.config.ShardReplicas {
+			break
+		}
+		if contact.ID == nil || contact.ID.Equals(self.ID) {
+			continue
+		}
+		if err := node.Client.SendStoreAtMessage(key, record, ttl, contact); err != nil {
+			log.Printf("failed to store shard %s at %s: %v\n", key, contact.String(), err)
+			continue
+		}
+		stored++
+	}
+	if stored == 0 {
+		return 0, fmt.Errorf("no node accepted shard %s", key)
+	}
+	return stored, nil
+}
+
+// GetErasure fetches the erasure manifest stored under key, requests all of its shards in
+// parallel and reconstructs the value as soon as enough of them have arrived
+func (node *Node) GetErasure(key string) ([]byte, error) {
+	resp, err := node.Client.SendFindValueMessage(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	var manifest ErasureManifest
+	if err := json.Unmarshal(resp.Payload.Data, &manifest); err != nil || manifest.Kind != erasureKind {
+		return nil, fmt.Errorf("value is not an erasure manifest")
+	}
+	n, m := len(manifest.Shards), manifest.DataShards
+	if err := checkErasureParams(n, m); err != nil {
+		return nil, err
+	}
+
+	type shardResult struct {
+		index int
+		data  []byte
+	}
+	results := make(chan shardResult, n)
+	var wg sync.WaitGroup
+	for i, shardKey := range manifest.Shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := node.Client.SendFindValueMessage(shardKey)
+			value := resp.Payload.Data
+			if err != nil || !MatchesData(shardKey, value) || len(value) < 1 || int(value[0]) != i {
+				results <- shardResult{index: i}
+				return
+			}
+			results <- shardResult{index: i, data: value[1:]}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	shards := make(map[int][]byte, m)
+	for result := range results {
+		if result.data == nil {
+			continue
+		}
+		shards[result.index] = result.data
+		if len(shards) == m {
+			return erasureDecode(shards, n, m, manifest.Size)
+		}
+	}
+	return nil, fmt.Errorf("only %d of the %d shards needed could be fetched", len(shards), m)
+}
@@ -0,0 +1,123 @@
+package kademlia
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shardHolders returns how many nodes other than publisher hold the value under key
+func shardHolders(nodes []*Kademlia, publisher *Kademlia, key string) int {
+	holders := 0
+	for _, node := range nodes {
+		if node == publisher {
+			continue
+		}
+		if _, ok := node.Node.Storage.Get(key); ok {
+			holders++
+		}
+	}
+	return holders
+}
+
+func Test_Erasure_PutGet(t *testing.T) {
+	nodes := newMockCluster(t, 5270, 6)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+	key, err := nodes[1].Node.PutErasure(data, 6, 4)
+	assert.NoError(t, err)
+
+	result, err := nodes[4].Node.GetErasure(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+}
+
+func Test_Erasure_ShardPlacement(t *testing.T) {
+	nodes := newMockCluster(t, 5280, 6)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+	key, err := nodes[1].Node.PutErasure(data, 6, 4)
+	assert.NoError(t, err)
+	resp, err := nodes[2].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+	var manifest ErasureManifest
+	assert.NoError(t, json.Unmarshal(resp.Payload.Data, &manifest))
+
+	// Every shard is held by a single node besides its publisher, not by the k closest
+	for _, shard := range manifest.Shards {
+		assert.Equal(t, 1, shardHolders(nodes, nodes[1], shard))
+	}
+
+	// Republishing, replication, audits and anti-entropy do not spread shards any further,
+	// even once the holders would replicate them
+	for _, node := range nodes {
+		for _, shard := range manifest.Shards {
+			if record, ok := node.Node.Storage.Get(shard); ok {
+				record.StoredAt = time.Now().Add(-2 * time.Hour)
+				node.Node.Storage.Put(shard, record)
+			}
+		}
+	}
+	for _, node := range nodes {
+		node.Node.Republish()
+		node.Node.Replicate()
+		node.Node.AuditReplicas()
+		node.Node.AntiEntropy()
+	}
+	for _, shard := range manifest.Shards {
+		assert.Equal(t, 1, shardHolders(nodes, nodes[1], shard))
+	}
+}
+
+func Test_Erasure_Get_LostShards(t *testing.T) {
+	nodes := newMockCluster(t, 5290, 6)
+
+	data := []byte("a value that survives losing some of its shards")
+	key, err := nodes[1].Node.PutErasure(data, 5, 3)
+	assert.NoError(t, err)
+	resp, err := nodes[2].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+	var manifest ErasureManifest
+	assert.NoError(t, json.Unmarshal(resp.Payload.Data, &manifest))
+
+	// Any two shards may be lost
+	lose := func(i int) {
+		for _, node := range nodes {
+			node.Node.Storage.Delete(manifest.Shards[i])
+		}
+	}
+	lose(0)
+	lose(3)
+	result, err := nodes[4].Node.GetErasure(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+
+	// A third one may not. Lookups still in flight from the last fetch may cache shard 4 again
+	// after it is lost, so it is lost until those have settled
+	assert.Eventually(t, func() bool {
+		lose(4)
+		_, err := nodes[4].Node.GetErasure(key)
+		return err != nil
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func Test_Erasure_Put_ShardTooLarge(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClientStore{})
+	_, err := node.PutErasure(make([]byte, 3*chunkSize), 3, 2)
+	assert.Error(t, err)
+}
+
+func Test_Erasure_Get_NotManifest(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+	resp, _ := client.SendStoreMessage([]byte("plain value"))
+	_, err := node.GetErasure(resp.Payload.Key)
+	assert.Error(t, err)
+}
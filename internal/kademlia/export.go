@@ -0,0 +1,134 @@
+package kademlia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Exports are JSON Lines: one JSON object per stored value, holding its key next to the
+// fields of its Record, with the data base64 encoded, e.g.
+//
+//	{"key":"<key in hex>","data":"aGVsbG8=","stored_at":"...","expires_at":"...","publisher":true}
+//
+// Mutable records also carry "pub", "salt", "seq" and "sig", owned values "owner", "seq" and
+// "sig", deleted ones "tombstone", erasure shards "shard", and versioned values "name" and
+// "siblings" instead of "data".
+// An export can be imported by any node, which checks every value against its key first
+
+// ExportEntry is one line of an export
+type ExportEntry struct {
+	Key string `json:"key"`
+	Record
+}
+
+// Export writes every unexpired value this node holds to w, one JSON line per value,
+// and returns the number of values written
+func (node *Node) Export(w io.Writer) (int, error) {
+	return ExportStorage(node.Storage, w)
+}
+
+// ExportStorage writes every unexpired value in storage to w like Export, without a running node,
+// e.g. to back up the store of a node that is stopped
+func ExportStorage(storage Storage, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	now := time.Now()
+	count := 0
+	var err error
+	storage.ForEach(func(key string, record Record) bool {
+		if record.Expired(now) {
+			return true
+		}
+		if err = encoder.Encode(ExportEntry{Key: key, Record: record}); err != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to write export: %w", err)
+	}
+	return count, nil
+}
+
+// Import stores every value read from an export in r. Values that do not match their key and
+// expired values are skipped. With republish set, imported values are also stored at the nodes
+// closest to them. Returns the number of values imported
+func (node *Node) Import(r io.Reader, republish bool) (int, error) {
+	decoder := json.NewDecoder(r)
+	count := 0
+	for line := 1; ; line++ {
+		var entry ExportEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return count, nil
+			}
+			return count, fmt.Errorf("failed to read export entry %d: %w", line, err)
+		}
+
+		now := time.Now()
+		record := entry.Record
+		if record.Expired(now) {
+			continue
+		}
+		if err := verifyValue(entry.Key, Payload{}.withRecord(record)); err != nil {
+			log.Printf("skipping imported %s: %v\n", entry.Key, err)
+			continue
+		}
+		if err := node.Store(entry.Key, record); err != nil {
+			log.Printf("failed to import %s: %v\n", entry.Key, err)
+			continue
+		}
+		count++
+
+		if !republish {
+			continue
+		}
+		ttl := node.config.ValueTTL
+		if !record.ExpiresAt.IsZero() {
+			ttl = record.ExpiresAt.Sub(now)
+		}
+		if _, err := node.Client.SendStoreValueMessage(entry.Key, record, ttl); err != nil {
+			log.Printf("failed to republish imported %s: %v\n", entry.Key, err)
+		}
+	}
+}
+
+// ExportFile writes an export of this node's values to path
+func (node *Node) ExportFile(path string) (string, error) {
+	return ExportStorageFile(node.Storage, path)
+}
+
+// ExportStorageFile writes an export of the values in storage to path
+func ExportStorageFile(storage Storage, path string) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	count, err := ExportStorage(storage, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Exported %d values to %s\n", count, path), nil
+}
+
+// ImportFile loads the export at path, optionally republishing the values
+func (node *Node) ImportFile(path string, republish bool) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	count, err := node.Import(file, republish)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Imported %d values from %s\n", count, path), nil
+}
@@ -0,0 +1,95 @@
+package kademlia
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Export_RoundTrip(t *testing.T) {
+	source, _ := InitNode(true, "localhost:8000", "")
+	value := []byte("exported value")
+	key := NewKademliaIDFromData(value).String()
+	assert.NoError(t, source.Store(key, Record{Data: value, Publisher: true}))
+	expired := []byte("expired value")
+	source.Storage.Put(NewKademliaIDFromData(expired).String(), Record{Data: expired, ExpiresAt: time.Now().Add(-time.Second)})
+
+	var buf bytes.Buffer
+	count, err := source.Export(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, key, entry["key"])
+	assert.Equal(t, "ZXhwb3J0ZWQgdmFsdWU=", entry["data"])
+	assert.Equal(t, true, entry["publisher"])
+
+	target, _ := InitNode(true, "localhost:8001", "")
+	count, err = target.Import(&buf, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	record, ok := target.LookupRecord(key)
+	assert.True(t, ok)
+	assert.Equal(t, value, record.Data)
+	assert.True(t, record.Publisher)
+}
+
+func Test_Export_ExportStorageFile(t *testing.T) {
+	// A stopped node's store is exported straight from disk
+	dir := t.TempDir()
+	storage, err := NewDiskStorage(dir)
+	assert.NoError(t, err)
+	value := []byte("on disk")
+	key := NewKademliaIDFromData(value).String()
+	assert.NoError(t, storage.Put(key, Record{Data: value}))
+	assert.NoError(t, storage.Close())
+
+	storage, err = NewDiskStorage(dir)
+	assert.NoError(t, err)
+	defer storage.Close()
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	result, err := ExportStorageFile(storage, path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Exported 1 values to "+path+"\n", result)
+
+	target, _ := InitNode(true, "localhost:8000", "")
+	_, err = target.ImportFile(path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, value, target.LookupData(key))
+}
+
+func Test_Export_Import_SkipsMismatch(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := NewKademliaIDFromData([]byte("value")).String()
+	input := `{"key":"` + key + `","data":"b3RoZXI="}` + "\n"
+	count, err := node.Import(strings.NewReader(input), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Nil(t, node.LookupData(key))
+}
+
+func Test_Export_Import_Malformed(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	_, err := node.Import(strings.NewReader("not json\n"), false)
+	assert.Error(t, err)
+}
+
+func Test_Export_Import_Republish(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientRecorder{}
+	node.SetClient(client)
+
+	value := []byte("value")
+	key := NewKademliaIDFromData(value).String()
+	input, _ := json.Marshal(ExportEntry{Key: key, Record: Record{Data: value, Publisher: true}})
+	count, err := node.Import(bytes.NewReader(input), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, map[string]time.Duration{key: node.config.ValueTTL}, client.stored)
+}
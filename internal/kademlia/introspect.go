@@ -0,0 +1,182 @@
+package kademlia
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyInfo describes a stored value without its data
+type KeyInfo struct {
+	Key       string    `json:"key"`
+	Size      int       `json:"size"` // bytes of data, counting every sibling of a versioned value
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero means the value never expires
+	Source    Contact   `json:"source,omitempty"`
+	Publisher bool      `json:"publisher,omitempty"`
+	Cached    bool      `json:"cached,omitempty"`
+	Mutable   bool      `json:"mutable,omitempty"`
+	Seq       int64     `json:"seq,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Siblings  int       `json:"siblings,omitempty"`
+}
+
+// StorageSummary summarizes what a node stores and why it stores it
+type StorageSummary struct {
+	StorageStats
+	Published int `json:"published"` // values this node published itself
+	Replicas  int `json:"replicas"`  // values stored on behalf of other nodes
+	Cached    int `json:"cached"`    // copies cached along lookup paths
+	Deleted   int `json:"deleted"`   // tombstones of deleted records
+	ByteLimit int `json:"byte_limit,omitempty"`
+	Sources   int `json:"sources"`   // contacts this node stores values for
+	Providers int `json:"providers"` // keys with announced providers
+}
+
+func keyInfo(key string, record Record) KeyInfo {
+	return KeyInfo{
+		Key:       key,
+		Size:      recordSize(record),
+		StoredAt:  record.StoredAt,
+		ExpiresAt: record.ExpiresAt,
+		Source:    record.Source,
+		Publisher: record.Publisher,
+		Cached:    record.Cached,
+		Mutable:   record.IsMutable(),
+		Seq:       record.Seq,
+		Deleted:   record.Tombstone,
+		Siblings:  len(record.Siblings),
+	}
+}
+
+// Keys lists every unexpired value this node stores, sorted by key
+func (node *Node) Keys() []KeyInfo {
+	now := time.Now()
+	var keys []KeyInfo
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if !record.Expired(now) {
+			keys = append(keys, keyInfo(key, record))
+		}
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+// KeyInfo describes the value stored under key, if this node holds an unexpired one
+func (node *Node) KeyInfo(key string) (KeyInfo, bool) {
+	record, ok := node.Storage.Get(key)
+	if !ok || record.Expired(time.Now()) {
+		return KeyInfo{}, false
+	}
+	return keyInfo(key, record), true
+}
+
+// StorageSummary summarizes the unexpired values this node stores
+func (node *Node) StorageSummary() StorageSummary {
+	summary := StorageSummary{ByteLimit: node.config.StorageByteLimit}
+	sources := make(map[string]bool)
+	for _, info := range node.Keys() {
+		summary.Keys++
+		summary.Bytes += info.Size
+		switch {
+		case info.Deleted:
+			summary.Deleted++
+		case info.Publisher:
+			summary.Published++
+		case info.Cached:
+			summary.Cached++
+		default:
+			summary.Replicas++
+		}
+		if !info.Publisher {
+			sources[sourceKey(info.Source)] = true
+		}
+	}
+	summary.Sources = len(sources)
+
+	node.providers.mu.Lock()
+	summary.Providers = len(node.providers.sets)
+	node.providers.mu.Unlock()
+	return summary
+}
+
+// ListKeys formats the values this node stores, one per line
+func (node *Node) ListKeys() string {
+	keys := node.Keys()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d keys stored\n", len(keys))
+	for _, info := range keys {
+		fmt.Fprintf(&b, "%s %d bytes %s\n", info.Key, info.Size, keyKind(info))
+	}
+	return b.String()
+}
+
+// DescribeKey formats everything this node knows about the value stored under hash
+func (node *Node) DescribeKey(hash string) (string, error) {
+	keyID, err := node.config.KeySpace.Parse(hash)
+	if err != nil {
+		return "", err
+	}
+	info, ok := node.KeyInfo(keyID.String())
+	if !ok {
+		return "", fmt.Errorf("key %s is not stored on this node", keyID.String())
+	}
+
+	expires := "never"
+	if !info.ExpiresAt.IsZero() {
+		expires = info.ExpiresAt.Format(time.RFC3339)
+	}
+	source := "self"
+	if !info.Publisher {
+		source = info.Source.String()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Key: %s\nKind: %s\nSize: %d bytes\n", info.Key, keyKind(info), info.Size)
+	fmt.Fprintf(&b, "Stored at: %s\nExpires at: %s\nSource: %s\n", info.StoredAt.Format(time.RFC3339), expires, source)
+	if info.Mutable {
+		fmt.Fprintf(&b, "Seq: %d\n", info.Seq)
+	}
+	if info.Siblings > 0 {
+		fmt.Fprintf(&b, "Siblings: %d\n", info.Siblings)
+	}
+	return b.String(), nil
+}
+
+// DescribeStorage formats the storage summary of this node
+func (node *Node) DescribeStorage() string {
+	summary := node.StorageSummary()
+	limit := "unlimited"
+	if summary.ByteLimit > 0 {
+		limit = fmt.Sprintf("%d bytes", summary.ByteLimit)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Keys: %d\nBytes: %d\nLimit: %s\n", summary.Keys, summary.Bytes, limit)
+	fmt.Fprintf(&b, "Published: %d\nReplicas: %d\nCached: %d\nDeleted: %d\n", summary.Published, summary.Replicas, summary.Cached, summary.Deleted)
+	fmt.Fprintf(&b, "Sources: %d\nProvider keys: %d\n", summary.Sources, summary.Providers)
+	return b.String()
+}
+
+// keyKind names the role of a stored value on this node
+func keyKind(info KeyInfo) string {
+	var kinds []string
+	switch {
+	case info.Publisher:
+		kinds = append(kinds, "published")
+	case info.Cached:
+		kinds = append(kinds, "cached")
+	default:
+		kinds = append(kinds, "replica")
+	}
+	if info.Mutable {
+		kinds = append(kinds, "mutable")
+	}
+	if info.Siblings > 0 {
+		kinds = append(kinds, "versioned")
+	}
+	if info.Deleted {
+		kinds = append(kinds, "deleted")
+	}
+	return strings.Join(kinds, ",")
+}
@@ -0,0 +1,60 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Introspect_Keys(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	source := Contact{ID: NewRandomKademliaID(), Address: "localhost:8001"}
+	published := []byte("published")
+	replica := []byte("replica")
+	assert.NoError(t, node.Store(NewKademliaIDFromData(published).String(), Record{Data: published, Publisher: true, Source: node.GetSelfContact()}))
+	assert.NoError(t, node.Store(NewKademliaIDFromData(replica).String(), Record{Data: replica, Source: source}))
+	node.Storage.Put(NewKademliaIDFromData([]byte("old")).String(), Record{Data: []byte("old"), ExpiresAt: time.Now().Add(-time.Minute)})
+
+	keys := node.Keys()
+	assert.Len(t, keys, 2)
+	assert.Less(t, keys[0].Key, keys[1].Key)
+
+	info, ok := node.KeyInfo(NewKademliaIDFromData(replica).String())
+	assert.True(t, ok)
+	assert.Equal(t, len(replica), info.Size)
+	assert.Equal(t, source.Address, info.Source.Address)
+	assert.False(t, info.Publisher)
+	assert.False(t, info.ExpiresAt.IsZero())
+
+	_, ok = node.KeyInfo(NewKademliaIDFromData([]byte("old")).String())
+	assert.False(t, ok)
+
+	summary := node.StorageSummary()
+	assert.Equal(t, 2, summary.Keys)
+	assert.Equal(t, len(published)+len(replica), summary.Bytes)
+	assert.Equal(t, 1, summary.Published)
+	assert.Equal(t, 1, summary.Replicas)
+	assert.Equal(t, 1, summary.Sources)
+}
+
+func Test_Introspect_DescribeKey(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := VersionedKey("cart").String()
+	assert.NoError(t, node.Store(key, versionedRecord("cart",
+		Sibling{Data: []byte("a"), Version: VersionVector{"a": 1}},
+		Sibling{Data: []byte("bb"), Version: VersionVector{"b": 1}})))
+
+	result, err := node.DescribeKey(key)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "Size: 3 bytes")
+	assert.Contains(t, result, "Kind: replica,versioned")
+	assert.Contains(t, result, "Siblings: 2")
+
+	_, err = node.DescribeKey(NewKademliaIDFromData([]byte("missing")).String())
+	assert.Error(t, err)
+	_, err = node.DescribeKey("not-a-key")
+	assert.Error(t, err)
+	_, err = node.DescribeKey(SHA256KeySpace.Sum([]byte("cart")).String())
+	assert.Error(t, err)
+}
@@ -1,8 +1,13 @@
 package kademlia
 
 import (
+	"crypto/ed25519"
+	"fmt"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type KademliaConfig struct {
@@ -11,6 +16,56 @@ type KademliaConfig struct {
 	BootstrapPingDelayMs int
 	isMockNetwork        bool
 	MockNetworkRegistry  *MockRegistry
+	Storage              Storage
+	ValueTTL             time.Duration // lifetime of a stored value unless the STORE carries its own TTL
+	ExpireInterval       time.Duration // how often expired values are purged from storage
+	ReplicateInterval    time.Duration // how often replicas re-store their values to the k closest nodes
+	RepublishInterval    time.Duration // how often the original publisher re-publishes its values
+	StorageByteLimit     int           // total bytes of values a node holds, 0 means unlimited
+	SourceByteQuota      int           // bytes of values a node holds for a single contact, 0 means unlimited
+	EvictionPolicy       EvictionPolicy
+	AuditInterval        time.Duration      // how often the node checks that its values are held by the k closest nodes
+	AntiEntropyInterval  time.Duration      // how often the node synchronises its values with its closest neighbours
+	TombstoneTTL         time.Duration      // how long a deleted record is remembered, longer than a republished value lives
+	KeySpace             KeySpace           // ID width and content hash, the same for every node of a network
+	RefreshInterval      time.Duration      // how long a bucket may go without a lookup before it is refreshed
+	K                    int                // contacts per bucket, replicas per value and contacts returned by a lookup
+	Alpha                int                // FIND_NODE requests a lookup keeps in flight at once
+	ContactFailureLimit  int                // requests in a row a contact may fail before it is replaced or evicted, 0 means never
+	RoutingTablePath     string             // file the node ID and routing table are saved to, empty means they are not saved
+	RoutingTableInterval time.Duration      // how often the routing table is saved
+	ShardReplicas        int                // nodes each erasure shard is stored at, instead of k
+	PublisherKey         ed25519.PrivateKey // owns the values the node publishes, generated when not given
+}
+
+// defaultConfig returns the configuration used for any option that is not given
+func defaultConfig() *KademliaConfig {
+	return &KademliaConfig{
+		SkipBootstrapPing:    false,
+		BootstrapPingRetries: 5,
+		BootstrapPingDelayMs: 500,
+		isMockNetwork:        false,
+		MockNetworkRegistry:  nil,
+		Storage:              nil,
+		ValueTTL:             24 * time.Hour,
+		ExpireInterval:       time.Minute,
+		ReplicateInterval:    time.Hour,
+		RepublishInterval:    24 * time.Hour,
+		StorageByteLimit:     0,
+		SourceByteQuota:      0,
+		EvictionPolicy:       FarthestFirstEviction{},
+		AuditInterval:        time.Hour,
+		AntiEntropyInterval:  10 * time.Minute,
+		TombstoneTTL:         48 * time.Hour,
+		KeySpace:             SHA1KeySpace,
+		RefreshInterval:      time.Hour,
+		K:                    bucketSize,
+		Alpha:                3,
+		ContactFailureLimit:  5,
+		RoutingTablePath:     "",
+		RoutingTableInterval: 5 * time.Minute,
+		ShardReplicas:        1,
+	}
 }
 
 type KademliaOption func(*KademliaConfig)
@@ -21,20 +76,163 @@ func WithSkipBootstrapPing(skip bool) KademliaOption {
 	}
 }
 
+// WithStorage makes the node keep its values in the given storage instead of in memory
+func WithStorage(storage Storage) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.Storage = storage
+	}
+}
+
+// WithValueTTL sets how long stored values live before they expire
+func WithValueTTL(ttl time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.ValueTTL = ttl
+	}
+}
+
+// WithExpireInterval sets how often the node purges expired values
+func WithExpireInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.ExpireInterval = interval
+	}
+}
+
+// WithReplicateInterval sets how often a node re-stores the values it holds
+func WithReplicateInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.ReplicateInterval = interval
+	}
+}
+
+// WithRepublishInterval sets how often a node re-publishes the values it published itself
+func WithRepublishInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.RepublishInterval = interval
+	}
+}
+
+// WithStorageLimit bounds the total bytes of values a node holds
+func WithStorageLimit(bytes int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.StorageByteLimit = bytes
+	}
+}
+
+// WithSourceQuota bounds the bytes of values a node holds on behalf of a single contact
+func WithSourceQuota(bytes int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.SourceByteQuota = bytes
+	}
+}
+
+// WithEvictionPolicy sets how a node makes room when the storage limit is reached
+func WithEvictionPolicy(policy EvictionPolicy) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.EvictionPolicy = policy
+	}
+}
+
+// WithAuditInterval sets how often a node audits and repairs the replicas of the values it holds
+func WithAuditInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.AuditInterval = interval
+	}
+}
+
+// WithAntiEntropyInterval sets how often a node synchronises its values with its closest neighbours
+func WithAntiEntropyInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.AntiEntropyInterval = interval
+	}
+}
+
+// WithTombstoneTTL sets how long nodes remember that a record was deleted
+func WithTombstoneTTL(ttl time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.TombstoneTTL = ttl
+	}
+}
+
+// WithShardReplicas sets how many of the closest nodes of its key each erasure shard is stored at.
+// The redundancy of erasure coded values comes from their extra shards, so one is usually enough
+func WithShardReplicas(replicas int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.ShardReplicas = replicas
+	}
+}
+
+// WithKeySpace sets the ID width and content hash of the network, e.g. SHA256KeySpace for 256-bit IDs
+func WithKeySpace(keySpace KeySpace) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.KeySpace = keySpace
+	}
+}
+
+// WithRefreshInterval sets how long a bucket may go without a node lookup before it is refreshed
+func WithRefreshInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.RefreshInterval = interval
+	}
+}
+
+// WithK sets k, the bucket size, the number of nodes a value is stored at and the number of
+// contacts lookups and FIND_NODE replies return
+func WithK(k int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.K = k
+	}
+}
+
+// WithAlpha sets alpha, the number of FIND_NODE requests a lookup sends in parallel
+func WithAlpha(alpha int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.Alpha = alpha
+	}
+}
+
+// WithContactFailureLimit sets how many requests in a row a contact may fail to answer before it
+// is replaced with a candidate from its bucket's replacement cache, or evicted from the routing
+// table when there is none. 0 keeps failing contacts
+func WithContactFailureLimit(limit int) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.ContactFailureLimit = limit
+	}
+}
+
+// WithPublisherKey sets the key that owns the values the node publishes. Only that key can delete
+// them, so a node that should delete its values after a restart must be given the same key again
+func WithPublisherKey(privateKey ed25519.PrivateKey) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.PublisherKey = privateKey
+	}
+}
+
+// WithRoutingTablePath makes the node save its ID and routing table to path and restore them from
+// it when it starts again
+func WithRoutingTablePath(path string) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.RoutingTablePath = path
+	}
+}
+
+// WithRoutingTableInterval sets how often the routing table is saved
+func WithRoutingTableInterval(interval time.Duration) KademliaOption {
+	return func(cfg *KademliaConfig) {
+		cfg.RoutingTableInterval = interval
+	}
+}
+
 type Kademlia struct {
 	Node   *Node
 	Server *Server
 	Client *Client
+
+	leaveOnce sync.Once
+	leaveErr  error
 }
 
 func InitKademlia(port string, bootstrap bool, bootstrapIP string, opts ...KademliaOption) (*Kademlia, error) {
-	cfg := &KademliaConfig{
-		SkipBootstrapPing:    false,
-		BootstrapPingRetries: 5,
-		BootstrapPingDelayMs: 500,
-		isMockNetwork:        false,
-		MockNetworkRegistry:  nil,
-	}
+	cfg := defaultConfig()
 	for _, opt := range opts {
 		opt(cfg)
 	}
@@ -49,10 +247,13 @@ func InitKademlia(port string, bootstrap bool, bootstrapIP string, opts ...Kadem
 
 	// Node
 	var nodeErr error
-	k.Node, nodeErr = InitNode(bootstrap, ip, bootstrapIP)
+	k.Node, nodeErr = newNode(bootstrap, ip, bootstrapIP, cfg)
 	if nodeErr != nil {
 		return nil, nodeErr
 	}
+	if cfg.Storage != nil {
+		k.Node.SetStorage(cfg.Storage)
+	}
 
 	// Network selection
 	var clientNet Network
@@ -75,7 +276,7 @@ func InitKademlia(port string, bootstrap bool, bootstrapIP string, opts ...Kadem
 
 	// Client
 	var clientErr error
-	k.Client, clientErr = InitClient(k.Node, clientNet)
+	k.Client, clientErr = newClient(k.Node, clientNet, cfg)
 	if clientErr != nil {
 		return nil, clientErr
 	}
@@ -97,9 +298,57 @@ func InitKademlia(port string, bootstrap bool, bootstrapIP string, opts ...Kadem
 		}
 	}
 
+	k.Node.leave = k.Leave
+	k.Node.Start()
+
 	return k, nil
 }
 
+// Leave hands every value this node stores over to the closest other nodes for its key, waits
+// for them to acknowledge it, and only then shuts down the node, its Client and its Server.
+// Cached copies and expired values are dropped. Calling Leave again returns the first result
+func (k *Kademlia) Leave() error {
+	k.leaveOnce.Do(func() {
+		k.Node.Stop()
+		if err := k.Node.SaveRoutingTable(); err != nil {
+			log.Printf("failed to save routing table: %v\n", err)
+		}
+
+		now := time.Now()
+		var keys []string
+		var records []Record
+		k.Node.Storage.ForEach(func(key string, record Record) bool {
+			if record.Cached || record.Expired(now) {
+				return true
+			}
+			keys = append(keys, key)
+			records = append(records, record)
+			return true
+		})
+
+		var failed atomic.Int32
+		_ = forEachParallel(len(keys), func(i int) error {
+			ttl := k.Node.config.ValueTTL
+			if !records[i].ExpiresAt.IsZero() {
+				ttl = records[i].ExpiresAt.Sub(now)
+			}
+			if _, err := k.Client.handoff(keys[i], records[i], ttl); err != nil {
+				log.Printf("failed to hand off %s: %v\n", keys[i], err)
+				failed.Add(1)
+			}
+			return nil
+		})
+
+		k.Client.Close()
+		k.Server.Close()
+
+		if n := failed.Load(); n > 0 {
+			k.leaveErr = fmt.Errorf("failed to hand off %d of %d values", n, len(keys))
+		}
+	})
+	return k.leaveErr
+}
+
 func GetLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -1,6 +1,7 @@
 package kademlia
 
 import (
+	"crypto/ed25519"
 	"testing"
 	"time"
 
@@ -65,3 +66,162 @@ func Test_kademlia_PingBetweenNodes(t *testing.T) {
 	assert.NoError(t, err2)
 	assert.Equal(t, "PONG", resp2.Type)
 }
+
+func Test_kademlia_InitKademlia_WithStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	k, err := InitKademlia("8002", true, "", WithSkipBootstrapPing(true), WithStorage(storage))
+	assert.NoError(t, err)
+	assert.Equal(t, storage, k.Node.Storage)
+}
+
+func Test_kademlia_ExpirationOptions(t *testing.T) {
+	cfg := defaultConfig()
+	WithValueTTL(time.Hour)(cfg)
+	WithExpireInterval(time.Second)(cfg)
+	assert.Equal(t, time.Hour, cfg.ValueTTL)
+	assert.Equal(t, time.Second, cfg.ExpireInterval)
+}
+
+func Test_kademlia_RepublishOptions(t *testing.T) {
+	cfg := defaultConfig()
+	WithReplicateInterval(time.Minute)(cfg)
+	WithRepublishInterval(time.Hour)(cfg)
+	assert.Equal(t, time.Minute, cfg.ReplicateInterval)
+	assert.Equal(t, time.Hour, cfg.RepublishInterval)
+}
+
+func Test_kademlia_AuditOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, time.Hour, cfg.AuditInterval)
+	WithAuditInterval(time.Minute)(cfg)
+	assert.Equal(t, time.Minute, cfg.AuditInterval)
+}
+
+func Test_kademlia_AntiEntropyOptions(t *testing.T) {
+	cfg := defaultConfig()
+	WithAntiEntropyInterval(time.Minute)(cfg)
+	assert.Equal(t, time.Minute, cfg.AntiEntropyInterval)
+}
+
+func Test_kademlia_TombstoneOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Greater(t, cfg.TombstoneTTL, cfg.ValueTTL)
+	WithTombstoneTTL(time.Hour)(cfg)
+	assert.Equal(t, time.Hour, cfg.TombstoneTTL)
+}
+
+func Test_kademlia_StorageLimitOptions(t *testing.T) {
+	cfg := defaultConfig()
+	WithStorageLimit(1024)(cfg)
+	WithSourceQuota(256)(cfg)
+	WithEvictionPolicy(LRUEviction{})(cfg)
+	assert.Equal(t, 1024, cfg.StorageByteLimit)
+	assert.Equal(t, 256, cfg.SourceByteQuota)
+	assert.Equal(t, LRUEviction{}, cfg.EvictionPolicy)
+}
+
+func Test_kademlia_Leave_HandsOffValues(t *testing.T) {
+	nodes := newMockCluster(t, 5130, 4)
+	data := []byte("handed off")
+	key := NewKademliaIDFromData(data).String()
+
+	// Only the leaving node holds the value
+	leaving := nodes[1]
+	assert.NoError(t, leaving.Node.Store(key, Record{Data: data, Publisher: true}))
+
+	assert.NoError(t, leaving.Leave())
+	assert.NoError(t, leaving.Leave())
+
+	holders := 0
+	for _, node := range nodes {
+		if node == leaving {
+			continue
+		}
+		if record, ok := node.Node.LookupRecord(key); ok {
+			holders++
+			assert.False(t, record.Publisher)
+		}
+	}
+	assert.Positive(t, holders)
+
+	resp, err := nodes[3].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, resp.Payload.Data)
+}
+
+func Test_kademlia_KeySpaceOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, SHA1KeySpace.Name, cfg.KeySpace.Name)
+	WithKeySpace(SHA256KeySpace)(cfg)
+	assert.Equal(t, 32, cfg.KeySpace.Length)
+}
+
+func Test_kademlia_SHA256Network(t *testing.T) {
+	nodes := newMockCluster(t, 5230, 4, WithKeySpace(SHA256KeySpace))
+	for _, node := range nodes {
+		assert.Len(t, *node.Node.Id, 32)
+	}
+
+	data := []byte("wide keys")
+	resp, err := nodes[1].Node.Publish(data)
+	assert.NoError(t, err)
+	key := SHA256KeySpace.Sum(data).String()
+	assert.Equal(t, key, resp.Payload.Key)
+
+	found, err := nodes[3].Client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, found.Payload.Data)
+}
+
+func Test_kademlia_RefreshOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, time.Hour, cfg.RefreshInterval)
+	WithRefreshInterval(time.Minute)(cfg)
+	assert.Equal(t, time.Minute, cfg.RefreshInterval)
+}
+
+func Test_kademlia_KAlphaOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, bucketSize, cfg.K)
+	assert.Equal(t, 3, cfg.Alpha)
+	WithK(8)(cfg)
+	WithAlpha(5)(cfg)
+	assert.Equal(t, 8, cfg.K)
+	assert.Equal(t, 5, cfg.Alpha)
+}
+
+func Test_kademlia_ContactFailureLimitOption(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, 5, cfg.ContactFailureLimit)
+	WithContactFailureLimit(2)(cfg)
+	assert.Equal(t, 2, cfg.ContactFailureLimit)
+}
+
+func Test_kademlia_RoutingTableOptions(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Empty(t, cfg.RoutingTablePath)
+	assert.Equal(t, 5*time.Minute, cfg.RoutingTableInterval)
+	WithRoutingTablePath("routingtable.json")(cfg)
+	WithRoutingTableInterval(time.Minute)(cfg)
+	assert.Equal(t, "routingtable.json", cfg.RoutingTablePath)
+	assert.Equal(t, time.Minute, cfg.RoutingTableInterval)
+}
+
+func Test_kademlia_PublisherKeyOption(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(nil)
+	cfg := defaultConfig()
+	assert.Nil(t, cfg.PublisherKey)
+	WithPublisherKey(privateKey)(cfg)
+	assert.Equal(t, privateKey, cfg.PublisherKey)
+
+	// A node without a publisher key generates one
+	node, _ := InitNode(true, "localhost:8000", "")
+	assert.Len(t, node.config.PublisherKey, ed25519.PrivateKeySize)
+}
+
+func Test_kademlia_ShardReplicasOption(t *testing.T) {
+	cfg := defaultConfig()
+	assert.Equal(t, 1, cfg.ShardReplicas)
+	WithShardReplicas(2)(cfg)
+	assert.Equal(t, 2, cfg.ShardReplicas)
+}
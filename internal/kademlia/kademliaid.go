@@ -1,48 +1,171 @@
 package kademlia
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
 	"math/rand"
+	"strings"
 )
 
+// IDLength is the width in bytes of IDs in the default, SHA-1 based key space
 const IDLength = 20
 
-type KademliaID [IDLength]byte
+// KeySpace is the ID width and content hash used by a network. Every node of a network must use
+// the same key space, and nodes refuse peers whose IDs have a different width
+type KeySpace struct {
+	Name   string
+	Length int // bytes per ID
+	hash   func(data []byte) []byte
+}
 
-func NewKademliaID(data string) *KademliaID {
-	decoded, _ := hex.DecodeString(data)
+var (
+	SHA1KeySpace = KeySpace{Name: "sha1", Length: IDLength, hash: func(data []byte) []byte {
+		sum := sha1.Sum(data)
+		return sum[:]
+	}}
+	SHA256KeySpace = KeySpace{Name: "sha256", Length: sha256.Size, hash: func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}}
+)
 
-	newKademliaID := KademliaID{}
-	for i := 0; i < IDLength; i++ {
-		newKademliaID[i] = decoded[i]
+var keySpaces = []KeySpace{SHA1KeySpace, SHA256KeySpace}
+
+// KeySpaceByName returns the key space with the given name, "sha1" or "sha256"
+func KeySpaceByName(name string) (KeySpace, error) {
+	for _, keySpace := range keySpaces {
+		if strings.EqualFold(keySpace.Name, name) {
+			return keySpace, nil
+		}
 	}
+	return KeySpace{}, fmt.Errorf("unknown key space %q", name)
+}
+
+// keySpaceOfLength returns the key space whose IDs are length bytes wide
+func keySpaceOfLength(length int) (KeySpace, bool) {
+	for _, keySpace := range keySpaces {
+		if keySpace.Length == length {
+			return keySpace, true
+		}
+	}
+	return KeySpace{}, false
+}
+
+// Bits returns the number of bits in an ID, which is also the number of buckets in a routing table
+func (keySpace KeySpace) Bits() int {
+	return keySpace.Length * 8
+}
+
+// Sum returns the ID of data in the key space, i.e. its hash
+func (keySpace KeySpace) Sum(data []byte) *KademliaID {
+	newKademliaID := KademliaID(keySpace.hash(data))
 	return &newKademliaID
 }
 
-// NewRandomKademliaID returns a new instance of a random KademliaID,
-// change this to a better version if you like
-func NewRandomKademliaID() *KademliaID {
-	newKademliaID := KademliaID{}
-	for i := 0; i < IDLength; i++ {
+// ZeroID returns the all zero ID, which the bootstrap node uses
+func (keySpace KeySpace) ZeroID() *KademliaID {
+	newKademliaID := make(KademliaID, keySpace.Length)
+	return &newKademliaID
+}
+
+// RandomID returns a new random ID in the key space
+func (keySpace KeySpace) RandomID() *KademliaID {
+	newKademliaID := make(KademliaID, keySpace.Length)
+	for i := range newKademliaID {
 		newKademliaID[i] = uint8(rand.Intn(256))
 	}
 	return &newKademliaID
 }
 
+// Parse parses a hex encoded ID, rejecting IDs of another width
+func (keySpace KeySpace) Parse(data string) (*KademliaID, error) {
+	id, err := ParseKademliaID(data)
+	if err != nil {
+		return nil, err
+	}
+	if !keySpace.Contains(id) {
+		return nil, fmt.Errorf("invalid KademliaID %q: want %d bytes, got %d", data, keySpace.Length, len(*id))
+	}
+	return id, nil
+}
+
+// Contains reports whether id has the width of the key space
+func (keySpace KeySpace) Contains(id *KademliaID) bool {
+	return id != nil && len(*id) == keySpace.Length
+}
+
+// KademliaID is a node ID or key. Its width depends on the key space of the network
+type KademliaID []byte
+
+// NewKademliaID decodes a hex encoded ID. Input that is not the width of a known key space
+// is cut or zero padded to IDLength bytes
+func NewKademliaID(data string) *KademliaID {
+	decoded, _ := hex.DecodeString(data)
+	if _, ok := keySpaceOfLength(len(decoded)); !ok {
+		padded := make([]byte, IDLength)
+		copy(padded, decoded)
+		decoded = padded
+	}
+	newKademliaID := KademliaID(decoded)
+	return &newKademliaID
+}
+
+// ParseKademliaID parses a hex encoded KademliaID, unlike NewKademliaID it rejects malformed input
+// and IDs that do not have the width of any key space
+func ParseKademliaID(data string) (*KademliaID, error) {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KademliaID %q: %w", data, err)
+	}
+	if _, ok := keySpaceOfLength(len(decoded)); !ok {
+		return nil, fmt.Errorf("invalid KademliaID %q: no key space has %d byte IDs", data, len(decoded))
+	}
+	newKademliaID := KademliaID(decoded)
+	return &newKademliaID, nil
+}
+
+// NewKademliaIDFromData returns the content key of data in the default key space, i.e. its SHA-1 hash
+func NewKademliaIDFromData(data []byte) *KademliaID {
+	return SHA1KeySpace.Sum(data)
+}
+
+// MatchesData reports whether key is the content key of data in the key space of the key's width
+func MatchesData(key string, data []byte) bool {
+	keySpace, ok := keySpaceOfLength(len(key) / 2)
+	if !ok || len(key)%2 != 0 {
+		return false
+	}
+	return strings.EqualFold(key, keySpace.Sum(data).String())
+}
+
+// NewRandomKademliaID returns a new instance of a random KademliaID in the default key space
+func NewRandomKademliaID() *KademliaID {
+	return SHA1KeySpace.RandomID()
+}
+
 // Less returns true if kademliaID < otherKademliaID (bitwise)
 func (kademliaID KademliaID) Less(otherKademliaID *KademliaID) bool {
-	for i := 0; i < IDLength; i++ {
-		if kademliaID[i] != otherKademliaID[i] {
-			return kademliaID[i] < otherKademliaID[i]
+	other := *otherKademliaID
+	for i := 0; i < len(kademliaID) && i < len(other); i++ {
+		if kademliaID[i] != other[i] {
+			return kademliaID[i] < other[i]
 		}
 	}
-	return false
+	return len(kademliaID) < len(other)
 }
 
 // Equals returns true if kademliaID == otherKademliaID (bitwise)
 func (kademliaID KademliaID) Equals(otherKademliaID *KademliaID) bool {
-	for i := 0; i < IDLength; i++ {
-		if kademliaID[i] != otherKademliaID[i] {
+	other := *otherKademliaID
+	if len(kademliaID) != len(other) {
+		return false
+	}
+	for i := range kademliaID {
+		if kademliaID[i] != other[i] {
 			return false
 		}
 	}
@@ -50,16 +173,58 @@ func (kademliaID KademliaID) Equals(otherKademliaID *KademliaID) bool {
 }
 
 // CalcDistance returns a new instance of a KademliaID that is built
-// through a bitwise XOR operation betweeen kademliaID and target
+// through a bitwise XOR operation betweeen kademliaID and target.
+// IDs of different widths are compared as if the shorter one was zero padded
 func (kademliaID KademliaID) CalcDistance(target *KademliaID) *KademliaID {
-	result := KademliaID{}
-	for i := 0; i < IDLength; i++ {
-		result[i] = kademliaID[i] ^ target[i]
+	other := *target
+	result := make(KademliaID, max(len(kademliaID), len(other)))
+	for i := range result {
+		if i < len(kademliaID) {
+			result[i] = kademliaID[i]
+		}
+		if i < len(other) {
+			result[i] ^= other[i]
+		}
 	}
 	return &result
 }
 
+// commonPrefixLen returns the number of leading bits a and b have in common
+func commonPrefixLen(a *KademliaID, b *KademliaID) int {
+	distance := *a.CalcDistance(b)
+	for i := range distance {
+		if distance[i] != 0 {
+			return i*8 + bits.LeadingZeros8(distance[i])
+		}
+	}
+	return len(distance) * 8
+}
+
 // String returns a simple string representation of a KademliaID
 func (kademliaID *KademliaID) String() string {
-	return hex.EncodeToString(kademliaID[0:IDLength])
+	return hex.EncodeToString(*kademliaID)
+}
+
+// MarshalJSON encodes the ID as a hex string, which carries its width on the wire
+func (kademliaID KademliaID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(kademliaID))
+}
+
+// UnmarshalJSON decodes an ID from a hex string, or from the array of bytes older nodes wrote
+func (kademliaID *KademliaID) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		var legacy []uint8
+		if json.Unmarshal(data, &legacy) != nil {
+			return fmt.Errorf("invalid KademliaID: %w", err)
+		}
+		*kademliaID = legacy
+		return nil
+	}
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid KademliaID %q: %w", encoded, err)
+	}
+	*kademliaID = decoded
+	return nil
 }
@@ -1,6 +1,8 @@
 package kademlia
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -60,3 +62,67 @@ func Test_KademliaID_Less(t *testing.T) {
 	assert.False(t, id5.Less(id6))
 	assert.True(t, id6.Less(id5))
 }
+
+func Test_KademliaID_NewKademliaIDFromData(t *testing.T) {
+	// SHA-1 of "hello"
+	id := NewKademliaIDFromData([]byte("hello"))
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", id.String())
+}
+
+func Test_KademliaID_MatchesData(t *testing.T) {
+	assert.True(t, MatchesData("aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", []byte("hello")))
+	assert.True(t, MatchesData("AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D", []byte("hello")))
+	assert.False(t, MatchesData("aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", []byte("world")))
+	assert.False(t, MatchesData("key", []byte("hello")))
+}
+
+func Test_KademliaID_ParseKademliaID(t *testing.T) {
+	id, err := ParseKademliaID("FFFFFFFF00000000000000000000000000000000")
+	assert.NoError(t, err)
+	assert.True(t, id.Equals(NewKademliaID("FFFFFFFF00000000000000000000000000000000")))
+
+	_, err = ParseKademliaID("key")
+	assert.Error(t, err)
+	_, err = ParseKademliaID("ffff")
+	assert.Error(t, err)
+}
+
+func Test_KademliaID_KeySpace(t *testing.T) {
+	keySpace, err := KeySpaceByName("SHA256")
+	assert.NoError(t, err)
+	assert.Equal(t, 256, keySpace.Bits())
+	_, err = KeySpaceByName("md5")
+	assert.Error(t, err)
+
+	// SHA-256 of "hello"
+	key := SHA256KeySpace.Sum([]byte("hello")).String()
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", key)
+	assert.True(t, MatchesData(key, []byte("hello")))
+	assert.False(t, MatchesData(key[:40], []byte("hello")))
+
+	id, err := SHA256KeySpace.Parse(key)
+	assert.NoError(t, err)
+	assert.True(t, SHA256KeySpace.Contains(id))
+	_, err = SHA1KeySpace.Parse(key)
+	assert.Error(t, err)
+
+	assert.Len(t, *SHA256KeySpace.RandomID(), 32)
+	assert.Equal(t, strings.Repeat("0", 64), SHA256KeySpace.ZeroID().String())
+	assert.False(t, SHA256KeySpace.ZeroID().Equals(SHA1KeySpace.ZeroID()))
+}
+
+func Test_KademliaID_JSON(t *testing.T) {
+	id := SHA256KeySpace.RandomID()
+	encoded, err := json.Marshal(Contact{ID: id, Address: "addr"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"id":"`+id.String()+`"`)
+
+	var contact Contact
+	assert.NoError(t, json.Unmarshal(encoded, &contact))
+	assert.True(t, contact.ID.Equals(id))
+
+	// Older nodes wrote IDs as arrays of bytes
+	var legacy Contact
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":[255,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1]}`), &legacy))
+	assert.Equal(t, "ff00000000000000000000000000000000000001", legacy.ID.String())
+}
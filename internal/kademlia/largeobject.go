@@ -0,0 +1,259 @@
+package kademlia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// chunkSize keeps every STORE and FIND_VALUE message well below maxPacketSize, the UDP read buffer
+	chunkSize         = 4096
+	chunkWorkers      = 4
+	manifestKind      = "manifest"
+	maxManifestLevels = 4
+)
+
+// Manifest describes a large object that was split into chunks, each stored under its own hash.
+// When the list of chunk keys itself is too large for one value, the chunks of an indirect
+// manifest reassemble into another manifest instead of the object
+type Manifest struct {
+	Kind     string   `json:"kind"`
+	Size     int      `json:"size"`
+	Chunks   []string `json:"chunks"`
+	Indirect bool     `json:"indirect,omitempty"`
+}
+
+// PutLarge splits data into chunks, publishes every chunk and a manifest listing them,
+// and returns the key of the manifest
+func (node *Node) PutLarge(data []byte) (string, error) {
+	manifest, err := node.putChunks(data)
+	if err != nil {
+		return "", err
+	}
+	for {
+		encoded, err := json.Marshal(manifest)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		if len(encoded) <= chunkSize {
+			if _, err := node.Publish(encoded); err != nil {
+				return "", fmt.Errorf("failed to store manifest: %w", err)
+			}
+			return node.config.KeySpace.Sum(encoded).String(), nil
+		}
+		// Too many chunks for a single value, chunk the manifest itself
+		manifest, err = node.putChunks(encoded)
+		if err != nil {
+			return "", err
+		}
+		manifest.Indirect = true
+	}
+}
+
+// putChunks publishes data in chunkSize pieces and returns the manifest listing them
+func (node *Node) putChunks(data []byte) (Manifest, error) {
+	manifest := Manifest{Kind: manifestKind, Size: len(data)}
+	var chunks [][]byte
+	for start := 0; start < len(data); start += chunkSize {
+		end := min(start+chunkSize, len(data))
+		chunks = append(chunks, data[start:end])
+		manifest.Chunks = append(manifest.Chunks, node.config.KeySpace.Sum(data[start:end]).String())
+	}
+
+	err := forEachParallel(len(chunks), func(i int) error {
+		if _, err := node.Publish(chunks[i]); err != nil {
+			return fmt.Errorf("failed to store chunk %d: %w", i, err)
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+// GetLarge fetches the manifest stored under key and reassembles the object it describes
+func (node *Node) GetLarge(key string) ([]byte, error) {
+	resp, err := node.Client.SendFindValueMessage(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	manifest, err := decodeManifest(resp.Payload.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	for level := 0; ; level++ {
+		data, err := node.getChunks(manifest)
+		if err != nil {
+			return nil, err
+		}
+		if !manifest.Indirect {
+			return data, nil
+		}
+		if level >= maxManifestLevels {
+			return nil, fmt.Errorf("manifest nested too deeply")
+		}
+		if manifest, err = decodeManifest(data); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DeleteLarge deletes the value under key that this node published. When it is a manifest, the
+// chunks it lists are deleted first, except those still listed by another manifest this node
+// published. The manifest is only deleted once all of its chunks are, so a DeleteLarge that
+// failed part way can simply be run again. Returns the number of chunks deleted
+func (node *Node) DeleteLarge(key string) (int, error) {
+	resp, err := node.Client.SendFindValueMessage(key)
+	if err != nil {
+		return 0, node.DeleteContent(key)
+	}
+	manifest, err := decodeManifest(resp.Payload.Data)
+	if err != nil {
+		return 0, node.DeleteContent(key)
+	}
+
+	chunks, err := node.manifestChunks(manifest, 0)
+	if err != nil {
+		return 0, err
+	}
+	shared, err := node.sharedChunks(key)
+	if err != nil {
+		return 0, err
+	}
+	var owned []string
+	for _, chunk := range chunks {
+		if !shared[chunk] {
+			owned = append(owned, chunk)
+		}
+	}
+
+	var count atomic.Int32
+	err = forEachParallel(len(owned), func(i int) error {
+		if err := node.DeleteContent(owned[i]); err != nil {
+			return fmt.Errorf("failed to delete chunk %s: %w", owned[i], err)
+		}
+		count.Add(1)
+		return nil
+	})
+	if err != nil {
+		return int(count.Load()), err
+	}
+	return int(count.Load()), node.DeleteContent(key)
+}
+
+// manifestChunks returns the distinct keys of every chunk of manifest, including those of the
+// manifest an indirect one reassembles into
+func (node *Node) manifestChunks(manifest Manifest, level int) ([]string, error) {
+	seen := make(map[string]bool)
+	var chunks []string
+	for {
+		for _, chunk := range manifest.Chunks {
+			if !seen[chunk] {
+				seen[chunk] = true
+				chunks = append(chunks, chunk)
+			}
+		}
+		if !manifest.Indirect {
+			return chunks, nil
+		}
+		if level >= maxManifestLevels {
+			return nil, fmt.Errorf("manifest nested too deeply")
+		}
+		data, err := node.getChunks(manifest)
+		if err != nil {
+			return nil, err
+		}
+		if manifest, err = decodeManifest(data); err != nil {
+			return nil, err
+		}
+		level++
+	}
+}
+
+// sharedChunks returns the chunks listed by the manifests other than key that this node published
+// and has not deleted, which must outlive the object under key
+func (node *Node) sharedChunks(key string) (map[string]bool, error) {
+	var manifests []Manifest
+	node.Storage.ForEach(func(k string, record Record) bool {
+		if k == key || !record.Publisher || record.Tombstone {
+			return true
+		}
+		if manifest, err := decodeManifest(record.Data); err == nil {
+			manifests = append(manifests, manifest)
+		}
+		return true
+	})
+
+	shared := make(map[string]bool)
+	for _, manifest := range manifests {
+		chunks, err := node.manifestChunks(manifest, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the chunks of another manifest: %w", err)
+		}
+		for _, chunk := range chunks {
+			shared[chunk] = true
+		}
+	}
+	return shared, nil
+}
+
+func decodeManifest(data []byte) (Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Kind != manifestKind {
+		return Manifest{}, fmt.Errorf("value is not a manifest")
+	}
+	return manifest, nil
+}
+
+// getChunks fetches every chunk of the manifest in parallel and verifies the reassembled size.
+// Each chunk is verified against its key by SendFindValueMessage
+func (node *Node) getChunks(manifest Manifest) ([]byte, error) {
+	chunks := make([][]byte, len(manifest.Chunks))
+	err := forEachParallel(len(manifest.Chunks), func(i int) error {
+		resp, err := node.Client.SendFindValueMessage(manifest.Chunks[i])
+		if err != nil {
+			return fmt.Errorf("failed to fetch chunk %d: %w", i, err)
+		}
+		if !MatchesData(manifest.Chunks[i], resp.Payload.Data) {
+			return fmt.Errorf("chunk %d does not match its key", i)
+		}
+		chunks[i] = resp.Payload.Data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := bytes.Join(chunks, nil)
+	if len(data) != manifest.Size {
+		return nil, fmt.Errorf("reassembled %d bytes, manifest says %d", len(data), manifest.Size)
+	}
+	return data, nil
+}
+
+// forEachParallel calls fn for 0..n-1 on at most chunkWorkers goroutines and returns the first error
+func forEachParallel(n int, fn func(i int) error) error {
+	indexes := make(chan int)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for range min(n, chunkWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
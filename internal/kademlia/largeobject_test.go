@@ -0,0 +1,215 @@
+package kademlia
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// MockClientStore keeps every stored value in a map, as if the whole network were one node
+type MockClientStore struct {
+	MockClient
+	values map[string][]byte
+	mu     sync.Mutex
+}
+
+func (mc *MockClientStore) SendStoreMessage(data []byte) (RPCMessage, error) {
+	key := NewKademliaIDFromData(data).String()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.values == nil {
+		mc.values = make(map[string][]byte)
+	}
+	mc.values[key] = data
+	return RPCMessage{Payload: Payload{Key: key}}, nil
+}
+
+func (mc *MockClientStore) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.values == nil {
+		mc.values = make(map[string][]byte)
+	}
+	mc.values[key] = record.Data
+	return RPCMessage{Payload: Payload{Key: key}}, nil
+}
+
+func (mc *MockClientStore) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	delete(mc.values, key)
+	return RPCMessage{Payload: Payload{Key: key}}, nil
+}
+
+func (mc *MockClientStore) SendFindValueMessage(hash string) (RPCMessage, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	data, ok := mc.values[hash]
+	if !ok {
+		return RPCMessage{}, fmt.Errorf("not found")
+	}
+	return RPCMessage{Payload: Payload{Key: hash, Data: data}}, nil
+}
+
+func Test_LargeObject_PutGet(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	data := make([]byte, 5*chunkSize+123)
+	rand.Read(data)
+	key, err := node.PutLarge(data)
+	assert.NoError(t, err)
+	// 6 chunks and the manifest
+	assert.Len(t, client.values, 7)
+
+	result, err := node.GetLarge(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+}
+
+func Test_LargeObject_DeleteLarge(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	data := make([]byte, 5*chunkSize+123)
+	rand.Read(data)
+	key, err := node.PutLarge(data)
+	assert.NoError(t, err)
+
+	// The manifest is deleted together with its 6 chunks
+	deleted, err := node.DeleteLarge(key)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, deleted)
+	assert.Empty(t, client.values)
+	_, err = node.GetLarge(key)
+	assert.Error(t, err)
+}
+
+// MockClientDeleteFails refuses to delete one key until it is reset
+type MockClientDeleteFails struct {
+	MockClientStore
+	failKey string
+}
+
+func (mc *MockClientDeleteFails) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	if key == mc.failKey {
+		return RPCMessage{}, fmt.Errorf("delete failed")
+	}
+	return mc.MockClientStore.SendDeleteMessage(key, record, ttl)
+}
+
+func Test_LargeObject_DeleteLarge_SharedChunk(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	// Both objects start with the same chunk
+	shared := make([]byte, chunkSize)
+	rand.Read(shared)
+	first := append(append([]byte{}, shared...), []byte("first")...)
+	second := append(append([]byte{}, shared...), []byte("second")...)
+	firstKey, err := node.PutLarge(first)
+	assert.NoError(t, err)
+	secondKey, err := node.PutLarge(second)
+	assert.NoError(t, err)
+
+	deleted, err := node.DeleteLarge(firstKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	result, err := node.GetLarge(secondKey)
+	assert.NoError(t, err)
+	assert.Equal(t, second, result)
+
+	// The last object listing the chunk takes it along
+	deleted, err = node.DeleteLarge(secondKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Empty(t, client.values)
+}
+
+func Test_LargeObject_DeleteLarge_Resume(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientDeleteFails{}
+	node.SetClient(client)
+
+	data := make([]byte, 3*chunkSize)
+	rand.Read(data)
+	key, err := node.PutLarge(data)
+	assert.NoError(t, err)
+	resp, _ := client.SendFindValueMessage(key)
+	manifest, _ := decodeManifest(resp.Payload.Data)
+
+	// A failed chunk keeps the manifest, so the delete can be run again
+	client.failKey = manifest.Chunks[1]
+	deleted, err := node.DeleteLarge(key)
+	assert.Error(t, err)
+	assert.Equal(t, 2, deleted)
+	_, err = client.SendFindValueMessage(key)
+	assert.NoError(t, err)
+
+	client.failKey = ""
+	deleted, err = node.DeleteLarge(key)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Empty(t, client.values)
+}
+
+func Test_LargeObject_IndirectManifest(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClientStore{})
+
+	// Enough chunks that their keys no longer fit in a single manifest value
+	data := make([]byte, 120*chunkSize)
+	rand.Read(data)
+	key, err := node.PutLarge(data)
+	assert.NoError(t, err)
+
+	result, err := node.GetLarge(key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+}
+
+func Test_LargeObject_Get_MissingChunk(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	data := make([]byte, 3*chunkSize)
+	rand.Read(data)
+	key, _ := node.PutLarge(data)
+	delete(client.values, NewKademliaIDFromData(data[:chunkSize]).String())
+
+	_, err := node.GetLarge(key)
+	assert.Error(t, err)
+}
+
+func Test_LargeObject_Get_SizeMismatch(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	chunk := []byte("chunk")
+	client.SendStoreMessage(chunk)
+	manifest, _ := json.Marshal(Manifest{Kind: manifestKind, Size: 100, Chunks: []string{NewKademliaIDFromData(chunk).String()}})
+	resp, _ := client.SendStoreMessage(manifest)
+
+	_, err := node.GetLarge(resp.Payload.Key)
+	assert.Error(t, err)
+}
+
+func Test_LargeObject_Get_NotManifest(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientStore{}
+	node.SetClient(client)
+
+	resp, _ := client.SendStoreMessage([]byte("plain value"))
+	_, err := node.GetLarge(resp.Payload.Key)
+	assert.Error(t, err)
+}
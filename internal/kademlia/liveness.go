@@ -0,0 +1,114 @@
+package kademlia
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ContactLiveness is what the routing table knows about how a contact has been answering.
+// Every reply or timeout seen by the Client updates it
+type ContactLiveness struct {
+	LastSeen time.Time     // when the contact last answered a request, zero if it never did
+	RTT      time.Duration // smoothed round-trip time of its answers
+	Failures int           // requests in a row it did not answer
+}
+
+// String returns a short summary for routing table dumps
+func (liveness ContactLiveness) String() string {
+	if liveness.LastSeen.IsZero() {
+		return fmt.Sprintf("never seen, %d failures", liveness.Failures)
+	}
+	return fmt.Sprintf("seen %s ago, rtt %s, %d failures",
+		time.Since(liveness.LastSeen).Round(time.Second), liveness.RTT.Round(time.Microsecond), liveness.Failures)
+}
+
+// responded records that the contact with id answered after rtt, callers must hold bucket.mu.
+// The RTT is smoothed like TCP's, each sample moves it an eighth of the way
+func (bucket *bucket) responded(id *KademliaID, rtt time.Duration, now time.Time) {
+	if findContact(bucket.list, id) == nil {
+		return
+	}
+	liveness := bucket.livenessOf(id)
+	liveness.LastSeen = now
+	liveness.Failures = 0
+	if liveness.RTT == 0 {
+		liveness.RTT = rtt
+	} else {
+		liveness.RTT += (rtt - liveness.RTT) / 8
+	}
+}
+
+// failed records that the contact with id did not answer, callers must hold bucket.mu.
+// Returns its consecutive failures, or 0 if it is not in the bucket
+func (bucket *bucket) failed(id *KademliaID) int {
+	if findContact(bucket.list, id) == nil {
+		return 0
+	}
+	liveness := bucket.livenessOf(id)
+	liveness.Failures++
+	return liveness.Failures
+}
+
+// livenessOf returns the entry of the contact with id, creating it if needed, callers must hold bucket.mu
+func (bucket *bucket) livenessOf(id *KademliaID) *ContactLiveness {
+	liveness, ok := bucket.liveness[id.String()]
+	if !ok {
+		liveness = &ContactLiveness{}
+		bucket.liveness[id.String()] = liveness
+	}
+	return liveness
+}
+
+// Liveness returns what is known about how the contact with id has been answering.
+// Reports false if the contact is not in the routing table
+func (routingTable *RoutingTable) Liveness(id *KademliaID) (ContactLiveness, bool) {
+	if !routingTable.accepts(id) {
+		return ContactLiveness{}, false
+	}
+	bucket := routingTable.buckets[routingTable.getBucketIndex(id)]
+	bucket.mu.RLock()
+	defer bucket.mu.RUnlock()
+	if findContact(bucket.list, id) == nil {
+		return ContactLiveness{}, false
+	}
+	if liveness, ok := bucket.liveness[id.String()]; ok {
+		return *liveness, true
+	}
+	return ContactLiveness{}, true
+}
+
+// ContactResponded records that c answered a request after rtt
+func (n *Node) ContactResponded(c Contact, rtt time.Duration) {
+	if !n.RoutingTable.accepts(c.ID) {
+		return
+	}
+	bucket := n.RoutingTable.buckets[n.RoutingTable.getBucketIndex(c.ID)]
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	bucket.responded(c.ID, rtt, time.Now())
+}
+
+// ContactFailed records that c did not answer a request. Once it failed ContactFailureLimit
+// requests in a row it is replaced with the most recently seen candidate from its bucket's
+// replacement cache, or evicted when there is none, so a single lost packet never costs a contact
+func (n *Node) ContactFailed(c Contact) {
+	if !n.RoutingTable.accepts(c.ID) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	bucket := n.RoutingTable.buckets[n.RoutingTable.getBucketIndex(c.ID)]
+	bucket.mu.Lock()
+	failures := bucket.failed(c.ID)
+	bucket.mu.Unlock()
+	if limit := n.config.ContactFailureLimit; failures == 0 || limit <= 0 || failures < limit {
+		return
+	}
+	if bucket.ReplaceContact(c.ID) {
+		log.Printf("replaced contact %s after %d failed requests\n", c.String(), failures)
+		return
+	}
+	bucket.RemoveContact(c.ID)
+	log.Printf("evicted contact %s after %d failed requests\n", c.String(), failures)
+}
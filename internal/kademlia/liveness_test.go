@@ -0,0 +1,92 @@
+package kademlia
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Liveness_Responded(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClient{})
+	contact := Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40)), Address: "1.2.3.4:8001"}
+	node.AddContact(contact)
+
+	liveness, ok := node.RoutingTable.Liveness(contact.ID)
+	assert.True(t, ok)
+	assert.True(t, liveness.LastSeen.IsZero())
+	assert.Contains(t, liveness.String(), "never seen")
+
+	node.ContactFailed(contact)
+	node.ContactResponded(contact, 80*time.Millisecond)
+	liveness, _ = node.RoutingTable.Liveness(contact.ID)
+	assert.False(t, liveness.LastSeen.IsZero())
+	assert.Equal(t, 80*time.Millisecond, liveness.RTT)
+	assert.Equal(t, 0, liveness.Failures)
+
+	// Later samples move the RTT an eighth of the way
+	node.ContactResponded(contact, 160*time.Millisecond)
+	liveness, _ = node.RoutingTable.Liveness(contact.ID)
+	assert.Equal(t, 90*time.Millisecond, liveness.RTT)
+	assert.True(t, strings.HasPrefix(liveness.String(), "seen "))
+}
+
+func Test_Liveness_UnknownContact(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	contact := Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40)), Address: "1.2.3.4:8001"}
+
+	node.ContactResponded(contact, time.Millisecond)
+	node.ContactFailed(contact)
+	_, ok := node.RoutingTable.Liveness(contact.ID)
+	assert.False(t, ok)
+}
+
+func Test_Liveness_EvictsAfterFailureLimit(t *testing.T) {
+	cfg := defaultConfig()
+	WithContactFailureLimit(3)(cfg)
+	node, _ := newNode(true, "localhost:8000", "", cfg)
+	node.SetClient(&MockClient{})
+	contact := Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40)), Address: "1.2.3.4:8001"}
+	node.AddContact(contact)
+	bucket := node.RoutingTable.buckets[node.RoutingTable.getBucketIndex(contact.ID)]
+
+	// An answer in between resets the count
+	node.ContactFailed(contact)
+	node.ContactFailed(contact)
+	node.ContactResponded(contact, time.Millisecond)
+	node.ContactFailed(contact)
+	node.ContactFailed(contact)
+	liveness, _ := node.RoutingTable.Liveness(contact.ID)
+	assert.Equal(t, 2, liveness.Failures)
+	assert.True(t, bucket.Contains(contact.ID))
+
+	node.ContactFailed(contact)
+	assert.False(t, bucket.Contains(contact.ID))
+	_, ok := node.RoutingTable.Liveness(contact.ID)
+	assert.False(t, ok)
+
+	// A contact that comes back starts over
+	node.AddContact(contact)
+	liveness, ok = node.RoutingTable.Liveness(contact.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 0, liveness.Failures)
+}
+
+func Test_Liveness_NoLimit(t *testing.T) {
+	cfg := defaultConfig()
+	WithContactFailureLimit(0)(cfg)
+	node, _ := newNode(true, "localhost:8000", "", cfg)
+	node.SetClient(&MockClient{})
+	contact := Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40)), Address: "1.2.3.4:8001"}
+	node.AddContact(contact)
+
+	for range 10 {
+		node.ContactFailed(contact)
+	}
+	liveness, ok := node.RoutingTable.Liveness(contact.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 10, liveness.Failures)
+}
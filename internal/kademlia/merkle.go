@@ -0,0 +1,270 @@
+package kademlia
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Anti-entropy between neighbouring replicas works on a Merkle tree over the stored keys, with one
+// level per hex digit of the key. A SYNC_TREE request for a prefix is answered with the hash of every
+// child subtree, or with the list of keys once the subtree is small. The requester only descends
+// into the children whose hashes differ from its own and transfers the values that differ
+
+const (
+	merkleDigits   = "0123456789abcdef"
+	merkleLeafSize = 32 // subtrees with at most this many values are listed instead of hashed
+)
+
+// MerkleEntry identifies a stored value, mutable records differ when their sequence numbers do
+// and versioned values when the versions of their siblings do
+type MerkleEntry struct {
+	Key     string `json:"key"`
+	Seq     int64  `json:"seq,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// MerkleSummary describes the values a node holds under a key prefix, either as the hashes of
+// the child subtrees (empty for a subtree without values) or as the values themselves
+type MerkleSummary struct {
+	Prefix   string        `json:"prefix"`
+	Children []string      `json:"children,omitempty"`
+	Entries  []MerkleEntry `json:"entries,omitempty"`
+}
+
+// SyncStats reports the work done by one anti-entropy exchange
+type SyncStats struct {
+	Requests int // SYNC_TREE requests sent
+	Pulled   int // values fetched from the neighbour
+	Pushed   int // values stored at the neighbour
+}
+
+// merkleEntries returns the values that take part in anti-entropy, sorted by key.
+// Cached copies, erasure shards and expired values are left out, so anti-entropy does not copy
+// them to every close neighbour
+func (node *Node) merkleEntries() []MerkleEntry {
+	now := time.Now()
+	var entries []MerkleEntry
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if !record.Cached && !record.Shard && !record.Expired(now) {
+			entries = append(entries, MerkleEntry{Key: strings.ToLower(key), Seq: record.Seq, Version: siblingsDigest(record.Siblings)})
+		}
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// merkleRange returns the entries whose key starts with prefix
+func merkleRange(entries []MerkleEntry, prefix string) []MerkleEntry {
+	start := sort.Search(len(entries), func(i int) bool { return entries[i].Key >= prefix })
+	end := start
+	for end < len(entries) && strings.HasPrefix(entries[end].Key, prefix) {
+		end++
+	}
+	return entries[start:end]
+}
+
+// merkleHash returns the hash of a subtree, or "" when it holds no values
+func merkleHash(entries []MerkleEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	h := sha1.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s:%d:%s\n", entry.Key, entry.Seq, entry.Version)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// merkleChildren returns the hash of every child subtree of prefix
+func merkleChildren(entries []MerkleEntry, prefix string) []string {
+	entries = merkleRange(entries, prefix)
+	children := make([]string, len(merkleDigits))
+	for i, digit := range merkleDigits {
+		children[i] = merkleHash(merkleRange(entries, prefix+string(digit)))
+	}
+	return children
+}
+
+// summarize builds the summary of prefix sent in reply to a SYNC_TREE request
+func summarize(entries []MerkleEntry, prefix string) MerkleSummary {
+	summary := MerkleSummary{Prefix: prefix}
+	entries = merkleRange(entries, prefix)
+	if len(entries) <= merkleLeafSize || len(prefix) >= len(entries[0].Key) {
+		summary.Entries = entries
+		return summary
+	}
+	summary.Children = merkleChildren(entries, prefix)
+	return summary
+}
+
+// MerkleSummary summarises the values this node holds under a key prefix
+func (node *Node) MerkleSummary(prefix string) MerkleSummary {
+	return summarize(node.merkleEntries(), strings.ToLower(prefix))
+}
+
+// SyncWith brings this node and contact in agreement about the values they both should hold.
+// Only subtrees whose hashes differ are explored, so the number of requests and transferred
+// values grows with the difference between the two nodes rather than with the number of values
+func (node *Node) SyncWith(contact Contact) (SyncStats, error) {
+	var stats SyncStats
+	local := node.merkleEntries()
+	prefixes := []string{""}
+	for len(prefixes) > 0 {
+		prefix := prefixes[len(prefixes)-1]
+		prefixes = prefixes[:len(prefixes)-1]
+
+		remote, err := node.Client.SendSyncTreeMessage(prefix, contact)
+		stats.Requests++
+		if err != nil {
+			return stats, err
+		}
+		if len(remote.Children) == 0 {
+			pulled, pushed := node.reconcile(contact, merkleRange(local, prefix), remote.Entries)
+			stats.Pulled += pulled
+			stats.Pushed += pushed
+			continue
+		}
+		mine := merkleChildren(local, prefix)
+		for i, hash := range remote.Children {
+			if i < len(mine) && hash != mine[i] {
+				prefixes = append(prefixes, prefix+string(merkleDigits[i]))
+			}
+		}
+	}
+	return stats, nil
+}
+
+// reconcile fetches the values contact has newer versions of and stores at contact the values
+// it lacks, limited to the keys both nodes are among the closest nodes for
+func (node *Node) reconcile(contact Contact, local []MerkleEntry, remote []MerkleEntry) (pulled int, pushed int) {
+	localEntries := make(map[string]MerkleEntry, len(local))
+	for _, entry := range local {
+		localEntries[entry.Key] = entry
+	}
+	remoteEntries := make(map[string]MerkleEntry, len(remote))
+	for _, entry := range remote {
+		remoteEntries[entry.Key] = entry
+	}
+
+	for _, entry := range remote {
+		if mine, ok := localEntries[entry.Key]; ok && mine.covers(entry) {
+			continue
+		}
+		if !node.isReplica(entry.Key, node.GetSelfContact()) {
+			continue
+		}
+		resp, err := node.Client.SendFindValueAtMessage(entry.Key, contact)
+		if err != nil || !resp.Payload.hasValue() {
+			continue
+		}
+		// Keep the lifetime the value has left at contact, so syncing never keeps a value alive
+		record := recordFromPayload(resp.Payload)
+		record.Source = contact
+		if ttl := resp.Payload.TTL; ttl > 0 {
+			record.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Second)
+		} else if record.Tombstone {
+			record.ExpiresAt = time.Now().Add(node.config.TombstoneTTL)
+		}
+		if err := node.Store(entry.Key, record); err != nil {
+			log.Printf("failed to keep synced %s: %v\n", entry.Key, err)
+			continue
+		}
+		pulled++
+	}
+
+	now := time.Now()
+	for _, entry := range local {
+		if theirs, ok := remoteEntries[entry.Key]; ok && theirs.covers(entry) {
+			continue
+		}
+		if !node.isReplica(entry.Key, contact) {
+			continue
+		}
+		record, ok := node.Storage.Get(entry.Key)
+		if !ok {
+			continue
+		}
+		ttl := node.config.ValueTTL
+		if !record.ExpiresAt.IsZero() {
+			ttl = record.ExpiresAt.Sub(now)
+		}
+		// TTLs are sent in whole seconds and 0 would give the value a fresh one
+		if ttl < time.Second {
+			continue
+		}
+		if err := node.Client.SendStoreAtMessage(entry.Key, record, ttl, contact); err != nil {
+			log.Printf("failed to sync %s to %s: %v\n", entry.Key, contact.String(), err)
+			continue
+		}
+		pushed++
+	}
+	return pulled, pushed
+}
+
+// covers reports whether the value entry describes is at least as new as the one other describes.
+// Versioned values with different siblings are exchanged both ways, since merging them is harmless
+func (entry MerkleEntry) covers(other MerkleEntry) bool {
+	return entry.Seq >= other.Seq && entry.Version == other.Version
+}
+
+// siblingsDigest returns a digest of the versions of siblings, or "" for values without siblings
+func siblingsDigest(siblings []Sibling) string {
+	if len(siblings) == 0 {
+		return ""
+	}
+	h := sha1.New()
+	for _, sibling := range siblings {
+		fmt.Fprintf(h, "%s;", sibling.Version.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isReplica reports whether contact is one of the K nodes closest to key that this node knows of,
+// counting this node itself
+func (node *Node) isReplica(key string, contact Contact) bool {
+	keyID, err := node.config.KeySpace.Parse(key)
+	if err != nil || contact.ID == nil {
+		return false
+	}
+	var candidates ContactCandidates
+	self := node.GetSelfContact()
+	self.CalcDistance(keyID)
+	candidates.Append([]Contact{self})
+	for _, c := range node.RoutingTable.FindClosestContacts(keyID, node.config.K+1) {
+		if !c.ID.Equals(self.ID) {
+			candidates.Append([]Contact{c})
+		}
+	}
+	candidates.Sort()
+	for _, c := range candidates.GetContacts(min(node.config.K, candidates.Len())) {
+		if c.ID.Equals(contact.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// AntiEntropy synchronises with the K contacts closest to this node, which hold most of the
+// same values, and returns the combined statistics
+func (node *Node) AntiEntropy() SyncStats {
+	var total SyncStats
+	for _, contact := range node.LookupClosestContacts(node.GetSelfContact()) {
+		if contact.ID == nil || contact.ID.Equals(node.Id) {
+			continue
+		}
+		stats, err := node.SyncWith(contact)
+		if err != nil {
+			log.Printf("anti-entropy with %s failed: %v\n", contact.String(), err)
+		}
+		total.Requests += stats.Requests
+		total.Pulled += stats.Pulled
+		total.Pushed += stats.Pushed
+	}
+	return total
+}
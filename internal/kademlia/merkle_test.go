@@ -0,0 +1,128 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func merkleTestEntries(n int) []MerkleEntry {
+	var entries []MerkleEntry
+	for i := range n {
+		entries = append(entries, MerkleEntry{Key: NewKademliaIDFromData([]byte(fmt.Sprint(i))).String()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+func Test_Merkle_Summarize(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	for i := range 100 {
+		data := []byte(fmt.Sprint(i))
+		node.Storage.Put(NewKademliaIDFromData(data).String(), Record{Data: data})
+	}
+	entries := node.merkleEntries()
+	assert.Len(t, entries, 100)
+
+	root := summarize(entries, "")
+	assert.Len(t, root.Children, 16)
+	assert.Empty(t, root.Entries)
+
+	leaf := summarize(entries, "a")
+	assert.Empty(t, leaf.Children)
+	assert.Equal(t, merkleRange(entries, "a"), leaf.Entries)
+	for _, entry := range leaf.Entries {
+		assert.Equal(t, byte('a'), entry.Key[0])
+	}
+
+	assert.Equal(t, summarize(merkleTestEntries(50), ""), summarize(merkleTestEntries(50), ""))
+	assert.NotEqual(t, summarize(merkleTestEntries(50), ""), summarize(merkleTestEntries(51), ""))
+}
+
+func Test_Merkle_HashDependsOnSeq(t *testing.T) {
+	entries := merkleTestEntries(1)
+	changed := []MerkleEntry{{Key: entries[0].Key, Seq: 1}}
+	assert.NotEqual(t, merkleHash(entries), merkleHash(changed))
+	assert.Equal(t, "", merkleHash(nil))
+}
+
+func Test_Merkle_SyncWith(t *testing.T) {
+	nodes := newMockCluster(t, 5160, 3)
+	a, b := nodes[1].Node, nodes[2].Node
+
+	// Both replicas share most values, each holds a few the other one lacks
+	for i := range 200 {
+		data := []byte(fmt.Sprint(i))
+		key := NewKademliaIDFromData(data).String()
+		assert.NoError(t, a.Store(key, Record{Data: data}))
+		assert.NoError(t, b.Store(key, Record{Data: data}))
+	}
+	onlyA := []byte("only on a")
+	onlyB := []byte("only on b")
+	assert.NoError(t, a.Store(NewKademliaIDFromData(onlyA).String(), Record{Data: onlyA}))
+	assert.NoError(t, b.Store(NewKademliaIDFromData(onlyB).String(), Record{Data: onlyB}))
+
+	stats, err := a.SyncWith(b.GetSelfContact())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Pulled)
+	assert.Equal(t, 1, stats.Pushed)
+	// The root and at most one subtree per differing value
+	assert.LessOrEqual(t, stats.Requests, 3)
+
+	assert.Equal(t, a.MerkleSummary(""), b.MerkleSummary(""))
+
+	// Converged replicas only compare their roots
+	stats, err = a.SyncWith(b.GetSelfContact())
+	assert.NoError(t, err)
+	assert.Equal(t, SyncStats{Requests: 1}, stats)
+}
+
+func Test_Merkle_SyncWith_KeepsExpiry(t *testing.T) {
+	nodes := newMockCluster(t, 5310, 3)
+	a, b := nodes[1].Node, nodes[2].Node
+
+	data := []byte("short lived")
+	key := NewKademliaIDFromData(data).String()
+	assert.NoError(t, b.Store(key, Record{Data: data, ExpiresAt: time.Now().Add(2 * time.Second)}))
+	_, privateKey := newTestKey(t)
+	deleted := MutableKey(privateKey.Public().(ed25519.PublicKey), nil).String()
+	tombstone := recordFromPayload(tombstonePayload(privateKey, nil, 1))
+	tombstone.ExpiresAt = time.Now().Add(time.Hour)
+	assert.NoError(t, b.Store(deleted, tombstone))
+
+	stats, err := a.SyncWith(b.GetSelfContact())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Pulled)
+
+	// The pulled copies live as long as the ones they were synced from, not a fresh TTL
+	record, ok := a.LookupRecord(key)
+	assert.True(t, ok)
+	assert.LessOrEqual(t, time.Until(record.ExpiresAt), 2*time.Second)
+	record, ok = a.LookupRecord(deleted)
+	assert.True(t, ok)
+	assert.True(t, record.Tombstone)
+	assert.LessOrEqual(t, time.Until(record.ExpiresAt), time.Hour)
+	assert.Greater(t, time.Until(record.ExpiresAt), 59*time.Minute)
+
+	// Syncing again does not keep the value alive
+	assert.Eventually(t, func() bool {
+		a.SyncWith(b.GetSelfContact())
+		b.SyncWith(a.GetSelfContact())
+		_, onA := a.LookupRecord(key)
+		_, onB := b.LookupRecord(key)
+		return !onA && !onB
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func Test_Merkle_HashDependsOnSiblings(t *testing.T) {
+	entries := merkleTestEntries(1)
+	a := []MerkleEntry{{Key: entries[0].Key, Version: siblingsDigest([]Sibling{{Version: VersionVector{"a": 1}}})}}
+	b := []MerkleEntry{{Key: entries[0].Key, Version: siblingsDigest([]Sibling{{Version: VersionVector{"b": 1}}})}}
+	assert.NotEqual(t, merkleHash(a), merkleHash(b))
+	assert.False(t, a[0].covers(b[0]))
+	assert.True(t, a[0].covers(a[0]))
+}
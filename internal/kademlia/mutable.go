@@ -0,0 +1,180 @@
+package kademlia
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Mutable records follow BEP44: the key is derived from an ed25519 public key and an optional
+// salt instead of from the data, so the publisher can update the value under a stable key.
+// Every record carries a sequence number and a signature over salt, sequence number and data,
+// and nodes only replace a stored record with one that has a higher sequence number
+
+const maxSaltSize = 64
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleSequence    = errors.New("sequence number not newer than stored record")
+)
+
+// MutableKey returns the key of a mutable record in the default key space, the SHA-1 of the
+// public key followed by the salt
+func MutableKey(publicKey ed25519.PublicKey, salt []byte) *KademliaID {
+	return SHA1KeySpace.MutableKey(publicKey, salt)
+}
+
+// MutableKey returns the key of a mutable record, the hash of the public key followed by the salt
+func (keySpace KeySpace) MutableKey(publicKey ed25519.PublicKey, salt []byte) *KademliaID {
+	return keySpace.Sum(append(append([]byte{}, publicKey...), salt...))
+}
+
+// mutableSignedBytes returns the bytes that are signed for a mutable record, encoded the way BEP44 does
+func mutableSignedBytes(salt []byte, seq int64, data []byte) []byte {
+	var buf bytes.Buffer
+	if len(salt) > 0 {
+		buf.WriteString("4:salt" + strconv.Itoa(len(salt)) + ":")
+		buf.Write(salt)
+	}
+	buf.WriteString("3:seqi" + strconv.FormatInt(seq, 10) + "e1:v" + strconv.Itoa(len(data)) + ":")
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// SignMutable signs a mutable record with the publisher's private key
+func SignMutable(privateKey ed25519.PrivateKey, salt []byte, seq int64, data []byte) []byte {
+	return ed25519.Sign(privateKey, mutableSignedBytes(salt, seq, data))
+}
+
+// IsMutable reports whether the record is a signed mutable record
+func (record Record) IsMutable() bool {
+	return len(record.PublicKey) > 0
+}
+
+// verifyValue checks that data may be stored under key: content addressed values must hash to
+// the key and be signed by their owner if they have one, while mutable records must be correctly
+// signed by the key derived from the public key
+func verifyValue(key string, payload Payload) error {
+	if payload.Name != "" {
+		return verifyVersioned(key, payload)
+	}
+	if len(payload.Owner) > 0 {
+		return verifyOwned(key, payload)
+	}
+	if len(payload.PublicKey) == 0 {
+		if payload.Tombstone {
+			return fmt.Errorf("only signed records can be deleted")
+		}
+		if !MatchesData(key, payload.Data) {
+			return fmt.Errorf("data does not match key")
+		}
+		return nil
+	}
+	if len(payload.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: bad public key size", ErrInvalidSignature)
+	}
+	if len(payload.Salt) > maxSaltSize {
+		return fmt.Errorf("salt longer than %d bytes", maxSaltSize)
+	}
+	if !MatchesData(key, append(append([]byte{}, payload.PublicKey...), payload.Salt...)) {
+		return fmt.Errorf("public key and salt do not match key")
+	}
+	signed := mutableSignedBytes(payload.Salt, payload.Seq, payload.Data)
+	if payload.Tombstone {
+		if len(payload.Data) > 0 {
+			return fmt.Errorf("tombstone carries data")
+		}
+		signed = tombstoneSignedBytes(payload.Salt, payload.Seq)
+	}
+	if !ed25519.Verify(payload.PublicKey, signed, payload.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// checkSequence refuses a mutable record that would replace a newer one. An equal sequence
+// number is accepted when the data is unchanged, so replicas can refresh the record
+func checkSequence(existing Record, record Record) error {
+	if !existing.IsMutable() || !bytes.Equal(existing.PublicKey, record.PublicKey) {
+		return nil
+	}
+	if record.Seq < existing.Seq || (record.Seq == existing.Seq && !bytes.Equal(record.Data, existing.Data)) {
+		return fmt.Errorf("%w: have %d, got %d", ErrStaleSequence, existing.Seq, record.Seq)
+	}
+	return nil
+}
+
+// PutMutable signs data with privateKey and stores it as sequence number seq under the key derived
+// from the public key and salt. The node keeps a copy as its publisher so it is republished
+func (client *Client) PutMutable(privateKey ed25519.PrivateKey, salt []byte, seq int64, data []byte) (string, error) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	key := client.config.KeySpace.MutableKey(publicKey, salt).String()
+	record := Record{
+		Data:      data,
+		PublicKey: publicKey,
+		Salt:      salt,
+		Seq:       seq,
+		Signature: SignMutable(privateKey, salt, seq, data),
+	}
+
+	if _, err := client.SendStoreValueMessage(key, record, client.config.ValueTTL); err != nil {
+		return "", err
+	}
+
+	keepPublished(client.node, key, record)
+	return key, nil
+}
+
+// GetMutable looks up the mutable record of publicKey and salt, asking every node close to the
+// key and returning the correctly signed record with the highest sequence number
+func (client *Client) GetMutable(publicKey ed25519.PublicKey, salt []byte) (Record, error) {
+	keyID := client.config.KeySpace.MutableKey(publicKey, salt)
+	key := keyID.String()
+
+	var best Record
+	found := false
+	if local, ok := client.node.LookupRecord(key); ok && bytes.Equal(local.PublicKey, publicKey) {
+		best, found = local, true
+	}
+
+	closest, err := client.node.IterativeFindNode(keyID)
+	if err != nil {
+		return Record{}, err
+	}
+
+	for _, contact := range closest {
+		request := NewRPCMessage("FIND_VALUE", Payload{Key: key}, true)
+		respChan, err := client.SendMessage(contact, request)
+		if err != nil {
+			continue
+		}
+
+		resp, ok := client.await(contact, respChan, 2*time.Second)
+		if !ok {
+			log.Println("FIND_VALUE Timeout for contact", contact.String())
+			continue
+		}
+		if (resp.Payload.Data == nil && !resp.Payload.Tombstone) || !bytes.Equal(resp.Payload.PublicKey, publicKey) {
+			continue
+		}
+		if err := verifyValue(key, resp.Payload); err != nil {
+			log.Println("FIND_VALUE discarding invalid mutable record from", contact.String())
+			continue
+		}
+		if !found || resp.Payload.Seq > best.Seq {
+			best, found = recordFromPayload(resp.Payload), true
+		}
+	}
+
+	if !found {
+		return Record{}, fmt.Errorf("mutable record not found on any contacted node")
+	}
+	if best.Tombstone {
+		return Record{}, ErrDeleted
+	}
+	return best, nil
+}
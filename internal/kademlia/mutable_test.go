@@ -0,0 +1,109 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	return publicKey, privateKey
+}
+
+func signedPayload(privateKey ed25519.PrivateKey, salt []byte, seq int64, data []byte) Payload {
+	return Payload{
+		Data:      data,
+		PublicKey: privateKey.Public().(ed25519.PublicKey),
+		Salt:      salt,
+		Seq:       seq,
+		Signature: SignMutable(privateKey, salt, seq, data),
+	}
+}
+
+func Test_Mutable_MutableKey(t *testing.T) {
+	publicKey, _ := newTestKey(t)
+	assert.Equal(t, MutableKey(publicKey, nil), MutableKey(publicKey, nil))
+	assert.NotEqual(t, MutableKey(publicKey, nil), MutableKey(publicKey, []byte("salt")))
+}
+
+func Test_Mutable_verifyValue(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	salt := []byte("salt")
+	key := MutableKey(publicKey, salt).String()
+
+	payload := signedPayload(privateKey, salt, 1, []byte("value"))
+	assert.NoError(t, verifyValue(key, payload))
+
+	tampered := payload
+	tampered.Data = []byte("other")
+	assert.ErrorIs(t, verifyValue(key, tampered), ErrInvalidSignature)
+
+	tampered = payload
+	tampered.Seq = 2
+	assert.ErrorIs(t, verifyValue(key, tampered), ErrInvalidSignature)
+
+	// Signed correctly, but not for the key it is stored under
+	assert.Error(t, verifyValue(MutableKey(publicKey, nil).String(), payload))
+
+	// Content addressed values are still checked against their hash
+	assert.NoError(t, verifyValue(NewKademliaIDFromData([]byte("value")).String(), Payload{Data: []byte("value")}))
+	assert.Error(t, verifyValue(key, Payload{Data: []byte("value")}))
+}
+
+func Test_Mutable_Node_Store_Sequence(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	publicKey, privateKey := newTestKey(t)
+	key := MutableKey(publicKey, nil).String()
+
+	store := func(seq int64, data string) error {
+		return node.Store(key, recordFromPayload(signedPayload(privateKey, nil, seq, []byte(data))))
+	}
+	assert.NoError(t, store(2, "two"))
+	assert.ErrorIs(t, store(1, "one"), ErrStaleSequence)
+	assert.ErrorIs(t, store(2, "changed"), ErrStaleSequence)
+	assert.NoError(t, store(2, "two"))
+	assert.NoError(t, store(3, "three"))
+
+	record, ok := node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), record.Seq)
+	assert.Equal(t, []byte("three"), record.Data)
+}
+
+func Test_Mutable_PutGet(t *testing.T) {
+	nodes := newMockCluster(t, 5100, 4)
+	publicKey, privateKey := newTestKey(t)
+	salt := []byte("profile")
+
+	key, err := nodes[1].Client.PutMutable(privateKey, salt, 1, []byte("first"))
+	assert.NoError(t, err)
+	assert.Equal(t, MutableKey(publicKey, salt).String(), key)
+
+	_, err = nodes[1].Client.PutMutable(privateKey, salt, 2, []byte("second"))
+	assert.NoError(t, err)
+
+	record, err := nodes[3].Client.GetMutable(publicKey, salt)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), record.Seq)
+	assert.Equal(t, []byte("second"), record.Data)
+
+	// Every replica refuses to go back to an older sequence number
+	_, err = nodes[2].Client.PutMutable(privateKey, salt, 1, []byte("first"))
+	assert.Error(t, err)
+
+	// The publisher keeps its own copy to republish
+	local, ok := nodes[1].Node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.True(t, local.Publisher)
+}
+
+func Test_Mutable_GetMissing(t *testing.T) {
+	nodes := newMockCluster(t, 5110, 2)
+	publicKey, _ := newTestKey(t)
+	_, err := nodes[1].Client.GetMutable(publicKey, nil)
+	assert.Error(t, err)
+}
@@ -2,6 +2,9 @@ package kademlia
 
 import "net"
 
+// maxPacketSize is the largest datagram ReceiveMessage reads, longer ones are cut off
+const maxPacketSize = 8192
+
 type UDPNetwork struct {
 	conn *net.UDPConn
 }
@@ -30,7 +33,7 @@ func (u *UDPNetwork) GetConn() string {
 }
 
 func (u *UDPNetwork) ReceiveMessage() (string, []byte, error) {
-	buf := make([]byte, 8192)
+	buf := make([]byte, maxPacketSize)
 	n, addr, err := u.conn.ReadFromUDP(buf)
 	if err != nil {
 		return "", nil, err
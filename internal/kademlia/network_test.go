@@ -97,3 +97,31 @@ func Test_Kademlia_NetworkEmulation_WithPacketDrop(t *testing.T) {
 		t.Logf("Bootstrap node successfully fetched value '%s' after deletions", val)
 	}
 }
+
+// newMockCluster starts a bootstrap node and n-1 peers on a shared mock network,
+// with ports counting up from basePort
+func newMockCluster(t *testing.T, basePort int, n int, opts ...KademliaOption) []*Kademlia {
+	t.Helper()
+	registry := NewMockRegistry()
+	mock := func(cfg *KademliaConfig) {
+		cfg.isMockNetwork = true
+		cfg.MockNetworkRegistry = registry
+	}
+	opts = append(opts, mock)
+
+	nodes := make([]*Kademlia, n)
+	bootstrapAddr := fmt.Sprintf("127.0.0.1:%d", basePort)
+	for i := range n {
+		node, err := InitKademlia(fmt.Sprintf("%d", basePort+i), i == 0, bootstrapAddr, opts...)
+		if err != nil {
+			t.Fatalf("InitKademlia failed for node %d: %v", i, err)
+		}
+		nodes[i] = node
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Node.Stop()
+		}
+	})
+	return nodes
+}
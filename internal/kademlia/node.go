@@ -1,54 +1,100 @@
 package kademlia
 
 import (
+	"crypto/ed25519"
+	"errors"
 	"log"
 	"sort"
 	"sync"
 	"time"
 )
 
-const alpha = 3
-
 type Node struct {
 	Id           *KademliaID
 	RoutingTable *RoutingTable
-	Storage      map[string][]byte
+	Storage      Storage
 	Client       ClientAPI
+	config       *KademliaConfig
+	usage        *storageUsage
+	storeMu      sync.Mutex
 	mu           sync.RWMutex
+	done         chan struct{}
+	stopOnce     sync.Once
+	leave        func() error // hands off values and shuts down, set by InitKademlia
+	replicaStats ReplicaStats
+	providers    *providerTable
+	auditMu      sync.Mutex
+	restored     []Contact  // saved before the last shutdown, pinged when joining
+	saveMu       sync.Mutex // serialises SaveRoutingTable, which reuses one temporary file
 }
 
 type NodeAPI interface {
 	GetSelfContact() Contact
 	AddContact(contact Contact)
+	ContactResponded(contact Contact, rtt time.Duration)
+	ContactFailed(contact Contact)
 	LookupClosestContacts(target Contact) []Contact
 	IterativeFindNode(target *KademliaID) ([]Contact, error)
 	LookupData(hash string) []byte
-	Store(key string, data []byte)
+	LookupRecord(key string) (Record, bool)
+	Store(key string, record Record) error
+	MerkleSummary(prefix string) MerkleSummary
+	AddProvider(key string, contact Contact, ttl time.Duration) error
+	LookupProviders(key string) []Contact
 }
 
 // InitNode initializes a new Node with a given IP address and bootstrap node address if not a bootstrap node
 func InitNode(isBootstrap bool, ip string, bootstrapIP string) (*Node, error) {
+	return newNode(isBootstrap, ip, bootstrapIP, defaultConfig())
+}
+
+func newNode(isBootstrap bool, ip string, bootstrapIP string, cfg *KademliaConfig) (*Node, error) {
 
 	var kademliaID *KademliaID
 	var me Contact
+	var restored []Contact
 
 	if isBootstrap {
-		kademliaID = NewKademliaID("0000000000000000000000000000000000000000")
+		kademliaID = cfg.KeySpace.ZeroID()
 	} else {
-		kademliaID = NewRandomKademliaID()
+		kademliaID = cfg.KeySpace.RandomID()
+	}
+	if cfg.RoutingTablePath != "" {
+		saved, err := loadRoutingTable(cfg.RoutingTablePath, cfg.KeySpace)
+		if err != nil {
+			log.Printf("ignoring saved routing table: %v\n", err)
+		} else if saved != nil {
+			// Peers keep the ID they had, so the values they hold are still theirs to serve
+			if !isBootstrap {
+				kademliaID = saved.ID
+			}
+			restored = saved.Contacts
+		}
+	}
+	if cfg.PublisherKey == nil {
+		_, privateKey, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PublisherKey = privateKey
 	}
 	me = NewContact(kademliaID, ip)
-	routingTable := NewRoutingTable(me)
+	routingTable := newRoutingTable(me, cfg.K)
 
 	if !isBootstrap {
-		bootstrap := NewContact(NewKademliaID("0000000000000000000000000000000000000000"), bootstrapIP)
+		bootstrap := NewContact(cfg.KeySpace.ZeroID(), bootstrapIP)
 		routingTable.AddContact(bootstrap)
 	}
 
 	node := &Node{
 		Id:           kademliaID,
 		RoutingTable: routingTable,
-		Storage:      make(map[string][]byte),
+		Storage:      NewMemoryStorage(),
+		config:       cfg,
+		usage:        newStorageUsage(),
+		providers:    newProviderTable(),
+		done:         make(chan struct{}),
+		restored:     restored,
 	}
 
 	return node, nil
@@ -58,7 +104,10 @@ func InitNode(isBootstrap bool, ip string, bootstrapIP string) (*Node, error) {
 func (node *Node) JoinNetwork() error {
 
 	selfID := node.GetSelfContact().ID
-	bootstrapID := NewKademliaID("0000000000000000000000000000000000000000")
+	bootstrapID := node.config.KeySpace.ZeroID()
+
+	// Contacts saved before a restart let the node rejoin even when the bootstrap node is down
+	node.pingRestored()
 
 	if selfID.Equals(bootstrapID) {
 		return nil
@@ -89,6 +138,8 @@ func (node *Node) JoinNetwork() error {
 			log.Printf("JoinNetwork: IterativeFindNode error: %v\n", err)
 			return err
 		}
+		// Fill the buckets farther away than the closest neighbour right away
+		node.refreshAfterJoin()
 		return nil
 	}
 }
@@ -97,6 +148,14 @@ func (node *Node) SetClient(client ClientAPI) {
 	node.Client = client
 }
 
+// SetStorage replaces the storage backend used for values held by this node
+func (node *Node) SetStorage(storage Storage) {
+	node.usage.mu.Lock()
+	defer node.usage.mu.Unlock()
+	node.Storage = storage
+	node.usage.loaded = false
+}
+
 func (node *Node) GetSelfContact() (self Contact) {
 	return node.RoutingTable.me
 }
@@ -105,7 +164,7 @@ func (node *Node) GetSelfContact() (self Contact) {
 // Use mutex only on critical sections to avoid deadlocks, and not on network calls
 func (n *Node) AddContact(c Contact) {
 
-	if c == n.GetSelfContact() {
+	if c == n.GetSelfContact() || !n.RoutingTable.accepts(c.ID) {
 		return
 	}
 
@@ -113,7 +172,7 @@ func (n *Node) AddContact(c Contact) {
 	bucketIndex := n.RoutingTable.getBucketIndex(c.ID)
 	bucket := n.RoutingTable.buckets[bucketIndex]
 	c.distance = n.Id.CalcDistance(c.ID)
-	if bucket.Len() < bucketSize {
+	if !bucket.Full() || bucket.Contains(c.ID) {
 		bucket.AddContact(c)
 		n.mu.Unlock()
 		return
@@ -131,21 +190,27 @@ func (n *Node) AddContact(c Contact) {
 
 	bucketIndex = n.RoutingTable.getBucketIndex(c.ID)
 	bucket = n.RoutingTable.buckets[bucketIndex]
-	if bucket.Len() < bucketSize {
-		bucket.AddContact(c)
-	} else if !alive {
-		bucket.list.Remove(bucket.list.Back())
+	if alive {
+		// The LRU contact counts as just seen, the newcomer waits in the replacement cache
+		bucket.AddContact(lru)
 		bucket.AddContact(c)
+		return
 	}
+	// The newcomer is the most recently seen candidate, so it takes the place of the dead contact
+	bucket.AddContact(c)
+	bucket.RemoveContact(lru.ID)
+	bucket.AddContact(c)
 }
 
 func (node *Node) LookupClosestContacts(target Contact) []Contact {
-	return node.RoutingTable.FindClosestContacts(target.ID, alpha)
+	return node.RoutingTable.FindClosestContacts(target.ID, node.config.K)
 }
 
-// IterativeFindNode performs an iterative lookup for the target ID, returning the alpha closest contacts found
+// IterativeFindNode performs an iterative lookup for the target ID, querying Alpha contacts at a time,
+// and returns the K closest contacts found
 // It avoids querying the same contact multiple times and handles timeouts
 func (node *Node) IterativeFindNode(target *KademliaID) ([]Contact, error) {
+	node.RoutingTable.markLookup(target, time.Now())
 	shortlist := node.LookupClosestContacts(NewContact(target, ""))
 	if len(shortlist) == 0 {
 		return nil, nil
@@ -166,7 +231,7 @@ func (node *Node) IterativeFindNode(target *KademliaID) ([]Contact, error) {
 			if c.ID == nil {
 				continue
 			}
-			if !queried[c.ID.String()] && len(batch) < alpha {
+			if !queried[c.ID.String()] && len(batch) < node.config.Alpha {
 				batch = append(batch, c)
 			}
 		}
@@ -202,7 +267,7 @@ func (node *Node) IterativeFindNode(target *KademliaID) ([]Contact, error) {
 				continue
 			}
 			for _, c := range contacts {
-				if c.ID == nil {
+				if !node.RoutingTable.accepts(c.ID) {
 					continue
 				}
 				if !queried[c.ID.String()] && !inShortlist[c.ID.String()] {
@@ -221,31 +286,246 @@ func (node *Node) IterativeFindNode(target *KademliaID) ([]Contact, error) {
 			return di.Less(dj)
 		})
 	}
-	k := alpha
+	k := node.config.K
 	if len(shortlist) < k {
 		k = len(shortlist)
 	}
 	return shortlist[:k], nil
 }
 
+// LookupData returns the value stored under hash, or nil if it is missing or has expired
 func (node *Node) LookupData(hash string) []byte {
-	node.mu.RLock()
-	defer node.mu.RUnlock()
-	data, ok := node.Storage[hash]
+	record, ok := node.LookupRecord(hash)
 	if !ok {
 		return nil
 	}
-	return data
+	return record.Data
+}
+
+// LookupRecord returns the record stored under key unless it is missing or has expired
+func (node *Node) LookupRecord(key string) (Record, bool) {
+	record, ok := node.Storage.Get(key)
+	if !ok {
+		return Record{}, false
+	}
+	if now := time.Now(); record.Expired(now) {
+		node.deleteExpired(key, now)
+		return Record{}, false
+	}
+	node.touch(key)
+	return record, true
 }
 
-func (node *Node) Store(key string, data []byte) {
-	node.mu.Lock()
-	defer node.mu.Unlock()
-	node.Storage[key] = data
+// Store keeps record under key. Records received from other nodes without an expiry get the
+// configured value TTL. The store is refused when it does not fit in the configured storage
+// limit or in the quota of the contact that sent it, or when it would replace a mutable record
+// with an older one
+func (node *Node) Store(key string, record Record) error {
+	now := time.Now()
+	record.StoredAt = now
+	if record.ExpiresAt.IsZero() && !record.Publisher {
+		record.ExpiresAt = now.Add(node.config.ValueTTL)
+	}
+
+	node.storeMu.Lock()
+	defer node.storeMu.Unlock()
+	if record.IsVersioned() {
+		record = node.mergeVersioned(key, record, now)
+	}
+	if existing, ok := node.Storage.Get(key); ok && !existing.Expired(now) {
+		if err := checkSequence(existing, record); err != nil {
+			return err
+		}
+		if len(existing.Owner) > 0 || len(record.Owner) > 0 {
+			if keep, err := checkOwner(existing, record); keep || err != nil {
+				return err
+			}
+		}
+		// Keep our own publisher copy when a replica of it comes back to us,
+		// and a replica when a cached copy of it arrives
+		if existing.Publisher && !record.Publisher && record.Seq <= existing.Seq {
+			return nil
+		}
+		if !existing.Cached && record.Cached && record.Seq <= existing.Seq {
+			return nil
+		}
+	}
+
+	node.usage.mu.Lock()
+	defer node.usage.mu.Unlock()
+	if node.limited() {
+		if err := node.reserve(key, record); err != nil {
+			return err
+		}
+	}
+	if err := node.Storage.Put(key, record); err != nil {
+		return err
+	}
+	// Once built, e.g. by StorageUsage, the usage is kept up to date even without a limit
+	if node.usage.loaded {
+		node.usage.add(key, record)
+	}
+	return nil
+}
+
+// Publish stores data in the network and keeps a copy as its original publisher,
+// so the node keeps republishing it for as long as it is running.
+// The value is owned by the node's publisher key, so DeleteContent can remove it again
+func (node *Node) Publish(data []byte) (RPCMessage, error) {
+	key := node.config.KeySpace.Sum(data).String()
+	record := ownedRecord(node.config.PublisherKey, key, data)
+	resp, err := node.Client.SendStoreValueMessage(key, record, node.config.ValueTTL)
+	if err != nil {
+		return resp, err
+	}
+	keepPublished(node, key, record)
+	return resp, nil
+}
+
+// keepPublished stores the copy of a value node has just published, marked as its publisher's so it
+// is republished. The value is already in the network, so a failure is only logged
+func keepPublished(node NodeAPI, key string, record Record) {
+	record.Publisher = true
+	record.Source = node.GetSelfContact()
+	if err := node.Store(key, record); err != nil {
+		log.Printf("failed to keep published %s: %v\n", key, err)
+	}
+}
+
+// Replicate re-stores every value held on behalf of others to the current k closest nodes.
+// Copies cached along lookup paths are left to expire, and erasure shards to their publisher.
+// Values that were stored here within the last interval are skipped, since the node that
+// sent them has just replicated them. Returns the number of values re-stored
+func (node *Node) Replicate() int {
+	now := time.Now()
+	count := 0
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if record.Publisher || record.Cached || record.Shard || record.Expired(now) || now.Sub(record.StoredAt) < node.config.ReplicateInterval {
+			return true
+		}
+		if _, err := node.Client.SendStoreValueMessage(key, record, record.ExpiresAt.Sub(now)); err != nil {
+			log.Printf("failed to replicate %s: %v\n", key, err)
+			return true
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// Republish re-publishes every value this node originally published with a fresh TTL.
+// Returns the number of values re-published
+func (node *Node) Republish() int {
+	count := 0
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if !record.Publisher {
+			return true
+		}
+		if record.Shard {
+			if _, err := node.storeShard(key, record, node.config.ValueTTL); err != nil {
+				log.Printf("failed to republish shard %s: %v\n", key, err)
+				return true
+			}
+			count++
+			return true
+		}
+		if _, err := node.Client.SendStoreValueMessage(key, record, node.config.ValueTTL); err != nil {
+			log.Printf("failed to republish %s: %v\n", key, err)
+			// The record was updated or deleted from another node, so this copy is no longer the
+			// latest and republishing it would bring the old value back once the newer one expires
+			if errors.Is(err, ErrStaleSequence) {
+				node.dropSuperseded(key, record.Seq)
+			}
+			return true
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// dropSuperseded deletes the publisher copy under key if it still has sequence number seq
+func (node *Node) dropSuperseded(key string, seq int64) {
+	node.storeMu.Lock()
+	defer node.storeMu.Unlock()
+	record, ok := node.Storage.Get(key)
+	if !ok || !record.Publisher || record.Seq != seq {
+		return
+	}
+	if err := node.removeLocked(key); err != nil {
+		log.Printf("failed to drop superseded %s: %v\n", key, err)
+	}
+}
+
+// PurgeExpired deletes every expired value from storage and returns how many were removed
+func (node *Node) PurgeExpired() int {
+	now := time.Now()
+	var expired []string
+	node.Storage.ForEach(func(key string, record Record) bool {
+		if record.Expired(now) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	removed := 0
+	for _, key := range expired {
+		deleted, err := node.deleteExpired(key, now)
+		if err != nil {
+			log.Printf("failed to purge expired %s: %v\n", key, err)
+		}
+		if deleted {
+			removed++
+		}
+	}
+	node.purgeProviders(now)
+	return removed
+}
+
+// Start launches the background maintenance loops of the node
+func (node *Node) Start() {
+	go node.runEvery(node.config.ExpireInterval, func() { node.PurgeExpired() })
+	go node.runEvery(node.config.ReplicateInterval, func() { node.Replicate() })
+	go node.runEvery(node.config.RepublishInterval, func() { node.Republish() })
+	go node.runEvery(node.config.AuditInterval, func() { node.AuditReplicas() })
+	go node.runEvery(node.config.AntiEntropyInterval, func() { node.AntiEntropy() })
+	go node.runEvery(node.config.RefreshInterval, func() { node.RefreshBuckets() })
+	if node.config.RoutingTablePath != "" {
+		go node.runEvery(node.config.RoutingTableInterval, func() {
+			if err := node.SaveRoutingTable(); err != nil {
+				log.Printf("failed to save routing table: %v\n", err)
+			}
+		})
+	}
+}
+
+// Stop terminates the background maintenance loops of the node
+func (node *Node) Stop() {
+	node.stopOnce.Do(func() {
+		close(node.done)
+	})
+}
+
+// runEvery calls fn every interval until the node is stopped
+func (node *Node) runEvery(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-node.done:
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
 }
 
 func (node *Node) PrintStore() {
-	log.Printf("Store: %v\n", node.Storage)
+	store := make(map[string][]byte)
+	node.Storage.ForEach(func(key string, record Record) bool {
+		store[key] = record.Data
+		return true
+	})
+	log.Printf("Store: %v\n", store)
 }
 
 func (node *Node) PrintRoutingTable() {
@@ -259,7 +539,8 @@ func (node *Node) PrintRoutingTable() {
 			log.Printf("Bucket %d:\n", i)
 			for e := bucket.list.Front(); e != nil; e = e.Next() {
 				contact := e.Value.(Contact)
-				log.Printf("  - %s\t(%s)\t[%s]\n", contact.Address, contact.ID.String(), contact.distance.String())
+				liveness, _ := node.RoutingTable.Liveness(contact.ID)
+				log.Printf("  - %s\t(%s)\t[%s]\t%s\n", contact.Address, contact.ID.String(), contact.distance.String(), liveness.String())
 			}
 		}
 		log.Println("==========================================================================================")
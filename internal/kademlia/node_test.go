@@ -3,6 +3,7 @@ package kademlia
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,9 +20,24 @@ func (mc *MockClient) SendFindNodeMessage(target *KademliaID, contact Contact) (
 func (mc *MockClient) SendStoreMessage(data []byte) (RPCMessage, error) {
 	return RPCMessage{}, nil
 }
+func (mc *MockClient) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClient) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
 func (mc *MockClient) SendFindValueMessage(hash string) (RPCMessage, error) {
 	return RPCMessage{}, nil
 }
+func (mc *MockClient) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClient) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	return nil
+}
+func (mc *MockClient) SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error) {
+	return MerkleSummary{Prefix: prefix}, nil
+}
 
 func Test_InitNode_Bootstrap(t *testing.T) {
 	node, err := InitNode(true, "localhost:8000", "")
@@ -121,6 +137,77 @@ func Test_Node_AddContact_FullBucket_Respond(t *testing.T) {
 	assert.False(t, found)
 }
 
+func Test_Node_AddContact_FullBucket_Replacement(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClient{})
+
+	contacts := make([]Contact, bucketSize)
+	for i := 0; i < bucketSize; i++ {
+		id := NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40+i))
+		contacts[i] = Contact{ID: id, Address: fmt.Sprintf("1.2.3.4:%d", 8001+i)}
+		node.AddContact(contacts[i])
+	}
+	bucket := node.RoutingTable.buckets[154]
+
+	// The LRU contact answers, so it is kept as just seen and the newcomer is cached
+	newContact := Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 60)), Address: "0.0.0.0:9999"}
+	node.AddContact(newContact)
+	assert.True(t, bucket.list.Front().Value.(Contact).ID.Equals(contacts[0].ID))
+	assert.Len(t, bucket.Replacements(), 1)
+	assert.True(t, bucket.Replacements()[0].ID.Equals(newContact.ID))
+
+	// A single timeout does not cost a resident its place
+	node.ContactFailed(contacts[5])
+	assert.True(t, bucket.Contains(contacts[5].ID))
+	assert.False(t, bucket.Contains(newContact.ID))
+
+	// A resident that keeps failing is replaced by the cached candidate
+	for range node.config.ContactFailureLimit - 1 {
+		node.ContactFailed(contacts[5])
+	}
+	assert.False(t, bucket.Contains(contacts[5].ID))
+	assert.True(t, bucket.Contains(newContact.ID))
+	assert.Equal(t, bucketSize, bucket.Len())
+
+	// Without candidates left, a failing contact is evicted
+	for range node.config.ContactFailureLimit {
+		node.ContactFailed(contacts[6])
+	}
+	assert.False(t, bucket.Contains(contacts[6].ID))
+	assert.Equal(t, bucketSize-1, bucket.Len())
+}
+
+// MockClientFindNodeError fails every FIND_NODE, reporting the failure to node like Client does
+type MockClientFindNodeError struct {
+	MockClient
+	node *Node
+}
+
+func (mc *MockClientFindNodeError) SendFindNodeMessage(target *KademliaID, contact Contact) ([]Contact, error) {
+	mc.node.ContactFailed(contact)
+	return nil, fmt.Errorf("no response")
+}
+
+func Test_Node_IterativeFindNode_ReplacesFailed(t *testing.T) {
+	cfg := defaultConfig()
+	WithContactFailureLimit(1)(cfg)
+	node, _ := newNode(true, "localhost:8000", "", cfg)
+	node.SetClient(&MockClient{})
+	for i := 0; i < bucketSize+1; i++ {
+		id := NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40+i))
+		node.AddContact(Contact{ID: id, Address: fmt.Sprintf("1.2.3.4:%d", 8001+i)})
+	}
+	bucket := node.RoutingTable.buckets[154]
+	candidate := bucket.Replacements()[0]
+
+	node.SetClient(&MockClientFindNodeError{node: node})
+	_, err := node.IterativeFindNode(NewKademliaID(fmt.Sprintf("%038d%02x", 0, 41)))
+	assert.NoError(t, err)
+	// The first contact to fail is replaced by the candidate, the others are evicted once no candidates are left
+	assert.True(t, bucket.Contains(candidate.ID))
+	assert.Less(t, bucket.Len(), bucketSize)
+}
+
 // MockClientNoRespond simulates ping failures
 type MockClientNoRespond struct{}
 
@@ -133,9 +220,24 @@ func (mc *MockClientNoRespond) SendFindNodeMessage(target *KademliaID, contact C
 func (mc *MockClientNoRespond) SendStoreMessage(data []byte) (RPCMessage, error) {
 	return RPCMessage{}, nil
 }
+func (mc *MockClientNoRespond) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClientNoRespond) SendDeleteMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
 func (mc *MockClientNoRespond) SendFindValueMessage(hash string) (RPCMessage, error) {
 	return RPCMessage{}, nil
 }
+func (mc *MockClientNoRespond) SendFindValueAtMessage(key string, contact Contact) (RPCMessage, error) {
+	return RPCMessage{}, nil
+}
+func (mc *MockClientNoRespond) SendStoreAtMessage(key string, record Record, ttl time.Duration, contact Contact) error {
+	return nil
+}
+func (mc *MockClientNoRespond) SendSyncTreeMessage(prefix string, contact Contact) (MerkleSummary, error) {
+	return MerkleSummary{Prefix: prefix}, nil
+}
 
 func Test_Node_AddContact_FullBucket_NoRespond(t *testing.T) {
 	node, _ := InitNode(true, "localhost:8000", "")
@@ -216,7 +318,8 @@ func Test_Node_LookupClosestContacts(t *testing.T) {
 	}
 	target := Contact{ID: NewRandomKademliaID(), Address: "localhost:8002"}
 	closest := node.LookupClosestContacts(target)
-	assert.LessOrEqual(t, len(closest), alpha)
+	assert.Len(t, closest, 5)
+	assert.LessOrEqual(t, len(closest), node.config.K)
 	for _, c := range closest {
 		assert.NotNil(t, c.ID)
 	}
@@ -248,7 +351,7 @@ func Test_Node_LookupData_Store(t *testing.T) {
 	node, _ := InitNode(true, "localhost:8000", "")
 	key := "testkey"
 	data := []byte("testdata")
-	node.Store(key, data)
+	node.Store(key, Record{Data: data})
 	result := node.LookupData(key)
 	assert.Equal(t, data, result)
 	// Lookup for non-existent key
@@ -258,7 +361,7 @@ func Test_Node_LookupData_Store(t *testing.T) {
 
 func Test_Node_PrintStore(t *testing.T) {
 	node, _ := InitNode(true, "localhost:8000", "")
-	node.Store("key", []byte("value"))
+	node.Store("key", Record{Data: []byte("value")})
 	node.PrintStore() // Just ensure no panic
 }
 
@@ -266,3 +369,140 @@ func Test_Node_PrintRoutingTable(t *testing.T) {
 	node, _ := InitNode(true, "localhost:8000", "")
 	node.PrintRoutingTable() // Just ensure no panic
 }
+
+func Test_Node_SetStorage(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	storage := NewMemoryStorage()
+	storage.Put("key", Record{Data: []byte("value")})
+	node.SetStorage(storage)
+	assert.Equal(t, []byte("value"), node.LookupData("key"))
+	node.Store("other", Record{Data: []byte("data")})
+	record, ok := storage.Get("other")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("data"), record.Data)
+}
+
+func Test_Node_Store_TTL(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.Store("default", Record{Data: []byte("value")})
+	record, _ := node.Storage.Get("default")
+	assert.WithinDuration(t, time.Now().Add(node.config.ValueTTL), record.ExpiresAt, time.Second)
+
+	node.Store("short", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(time.Minute)})
+	record, _ = node.Storage.Get("short")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), record.ExpiresAt, time.Second)
+}
+
+func Test_Node_LookupData_Expired(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.Storage.Put("old", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, node.LookupData("old"))
+	_, ok := node.Storage.Get("old")
+	assert.False(t, ok)
+}
+
+func Test_Node_PurgeExpired(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.Storage.Put("old", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(-time.Second)})
+	node.Store("fresh", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 1, node.PurgeExpired())
+	assert.Equal(t, 1, node.Storage.Stats().Keys)
+	assert.NotNil(t, node.LookupData("fresh"))
+}
+
+func Test_Node_DeleteExpired_KeepsRefreshed(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.Storage.Put("key", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(-time.Second)})
+	now := time.Now()
+
+	// A STORE refreshes the value after it was found expired, before it is deleted
+	assert.NoError(t, node.Store("key", Record{Data: []byte("value"), ExpiresAt: now.Add(time.Hour)}))
+	deleted, err := node.deleteExpired("key", now)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	assert.NotNil(t, node.LookupData("key"))
+}
+
+func Test_Node_ExpireLoop(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.config.ExpireInterval = 10 * time.Millisecond
+	node.Storage.Put("old", Record{Data: []byte("value"), ExpiresAt: time.Now().Add(-time.Second)})
+	node.Start()
+	defer node.Stop()
+	assert.Eventually(t, func() bool {
+		return node.Storage.Stats().Keys == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// MockClientRecorder records the values re-sent through SendStoreValueMessage
+type MockClientRecorder struct {
+	MockClient
+	stored map[string]time.Duration
+}
+
+func (mc *MockClientRecorder) SendStoreValueMessage(key string, record Record, ttl time.Duration) (RPCMessage, error) {
+	if mc.stored == nil {
+		mc.stored = make(map[string]time.Duration)
+	}
+	mc.stored[key] = ttl
+	return RPCMessage{}, nil
+}
+
+func Test_Node_Publish(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClient{})
+	_, err := node.Publish([]byte("value"))
+	assert.NoError(t, err)
+	record, ok := node.Storage.Get(NewKademliaIDFromData([]byte("value")).String())
+	assert.True(t, ok)
+	assert.True(t, record.Publisher)
+	assert.Equal(t, node.GetSelfContact(), record.Source)
+	assert.True(t, record.ExpiresAt.IsZero())
+}
+
+func Test_Node_Replicate(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientRecorder{}
+	node.SetClient(client)
+	now := time.Now()
+	node.Storage.Put("old", Record{Data: []byte("a"), StoredAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)})
+	node.Storage.Put("recent", Record{Data: []byte("b"), StoredAt: now, ExpiresAt: now.Add(time.Hour)})
+	node.Storage.Put("published", Record{Data: []byte("c"), StoredAt: now.Add(-2 * time.Hour), Publisher: true})
+
+	assert.Equal(t, 1, node.Replicate())
+	assert.Contains(t, client.stored, "old")
+	assert.InDelta(t, float64(time.Hour), float64(client.stored["old"]), float64(time.Second))
+}
+
+func Test_Node_Republish(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientRecorder{}
+	node.SetClient(client)
+	node.Storage.Put("published", Record{Data: []byte("c"), Publisher: true})
+	node.Storage.Put("replica", Record{Data: []byte("d")})
+
+	assert.Equal(t, 1, node.Republish())
+	assert.Equal(t, map[string]time.Duration{"published": node.config.ValueTTL}, client.stored)
+}
+
+func Test_Node_Replicate_SkipsCached(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	client := &MockClientRecorder{}
+	node.SetClient(client)
+	now := time.Now()
+	node.Storage.Put("cached", Record{Data: []byte("a"), StoredAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour), Cached: true})
+
+	assert.Equal(t, 0, node.Replicate())
+	assert.Empty(t, client.stored)
+}
+
+func Test_Node_Store_CachedKeepsReplica(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := NewKademliaIDFromData([]byte("a")).String()
+	assert.NoError(t, node.Store(key, Record{Data: []byte("a")}))
+	assert.NoError(t, node.Store(key, Record{Data: []byte("a"), ExpiresAt: time.Now().Add(time.Minute), Cached: true}))
+
+	record, ok := node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.False(t, record.Cached)
+}
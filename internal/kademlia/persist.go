@@ -0,0 +1,147 @@
+package kademlia
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The routing table is saved to RoutingTablePath together with the node's own ID, periodically and
+// on shutdown. A restarted node takes its old ID back and pings the saved contacts while joining,
+// so it can rejoin the network even when the bootstrap node is down
+
+// savedRoutingTable is the file format of a saved routing table
+type savedRoutingTable struct {
+	ID       *KademliaID `json:"id"`
+	Contacts []Contact   `json:"contacts"`
+}
+
+// Contacts returns every contact in the routing table other than this node's own, bucket by
+// bucket, most recently seen first
+func (routingTable *RoutingTable) Contacts() []Contact {
+	routingTable.mu.RLock()
+	defer routingTable.mu.RUnlock()
+	var contacts []Contact
+	for _, bucket := range routingTable.buckets {
+		bucket.mu.RLock()
+		for e := bucket.list.Front(); e != nil; e = e.Next() {
+			contact := e.Value.(Contact)
+			if !contact.ID.Equals(routingTable.me.ID) {
+				contacts = append(contacts, contact)
+			}
+		}
+		bucket.mu.RUnlock()
+	}
+	return contacts
+}
+
+// SaveRoutingTable writes the node's ID and routing table to RoutingTablePath, replacing the file
+// at once so a crash never leaves half of it behind. Saves are serialised, since the periodic
+// save may still be running when the node shuts down. Does nothing when no path is configured
+func (node *Node) SaveRoutingTable() error {
+	path := node.config.RoutingTablePath
+	if path == "" {
+		return nil
+	}
+	node.saveMu.Lock()
+	defer node.saveMu.Unlock()
+	data, err := json.Marshal(savedRoutingTable{ID: node.Id, Contacts: node.RoutingTable.Contacts()})
+	if err != nil {
+		return fmt.Errorf("failed to encode routing table: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// loadRoutingTable reads a routing table saved by SaveRoutingTable. Returns nil without an error
+// if there is none yet. Contacts from another key space are dropped
+func loadRoutingTable(path string, keySpace KeySpace) (*savedRoutingTable, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved savedRoutingTable
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if !keySpace.Contains(saved.ID) {
+		return nil, fmt.Errorf("saved ID is not a %s ID", keySpace.Name)
+	}
+	contacts := saved.Contacts[:0]
+	for _, contact := range saved.Contacts {
+		if keySpace.Contains(contact.ID) && contact.Address != "" {
+			contacts = append(contacts, contact)
+		}
+	}
+	saved.Contacts = contacts
+	return &saved, nil
+}
+
+// pingRestored pings the contacts saved before the last shutdown in parallel and adds the ones
+// that answer to the routing table. Returns how many answered
+func (node *Node) pingRestored() int {
+	contacts := node.restored
+	node.restored = nil
+	if len(contacts) == 0 {
+		return 0
+	}
+	var alive atomic.Int32
+	var wg sync.WaitGroup
+	for _, contact := range contacts {
+		wg.Add(1)
+		go func(c Contact) {
+			defer wg.Done()
+			resp, err := node.Client.SendPingMessage(c)
+			if err != nil || resp.Type != "PONG" {
+				return
+			}
+			node.AddContact(resp.Payload.SourceContact)
+			alive.Add(1)
+		}(contact)
+	}
+	wg.Wait()
+	log.Printf("%d of %d saved contacts answered\n", alive.Load(), len(contacts))
+	return int(alive.Load())
+}
+
+// LoadPublisherKey reads the publisher key saved at path, creating and saving a new one the first
+// time, so a restarted node can still delete the values it published. The file holds the hex
+// encoded seed of the key and is only readable by its owner
+func LoadPublisherKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, privateKey, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(privateKey.Seed())), 0o600); err != nil {
+			return nil, err
+		}
+		return privateKey, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s does not hold a publisher key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -0,0 +1,145 @@
+package kademlia
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Persist_SaveAndLoad(t *testing.T) {
+	cfg := defaultConfig()
+	WithRoutingTablePath(filepath.Join(t.TempDir(), "routingtable.json"))(cfg)
+	node, _ := newNode(false, "localhost:8000", "localhost:9000", cfg)
+	node.SetClient(&MockClient{})
+	node.RoutingTable.AddContact(node.GetSelfContact())
+	for i := range 3 {
+		node.AddContact(Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40+i)), Address: fmt.Sprintf("1.2.3.4:%d", 8001+i)})
+	}
+	assert.NoError(t, node.SaveRoutingTable())
+
+	// The restarted node has its old ID and the saved contacts, but not itself
+	restarted, _ := newNode(false, "localhost:8000", "localhost:9000", cfg)
+	assert.True(t, restarted.Id.Equals(node.Id))
+	assert.Len(t, restarted.restored, 4)
+	for _, contact := range restarted.restored {
+		assert.False(t, contact.ID.Equals(node.Id))
+	}
+
+	// The bootstrap node always uses the zero ID
+	bootstrap, _ := newNode(true, "localhost:8000", "", cfg)
+	assert.True(t, bootstrap.Id.Equals(cfg.KeySpace.ZeroID()))
+	assert.Len(t, bootstrap.restored, 4)
+}
+
+func Test_Persist_ConcurrentSaves(t *testing.T) {
+	cfg := defaultConfig()
+	WithRoutingTablePath(filepath.Join(t.TempDir(), "routingtable.json"))(cfg)
+	node, _ := newNode(false, "localhost:8000", "localhost:9000", cfg)
+	node.SetClient(&MockClient{})
+	node.AddContact(Contact{ID: NewKademliaID(fmt.Sprintf("%038d%02x", 0, 40)), Address: "1.2.3.4:8001"})
+
+	// The periodic save and the one on shutdown may overlap, neither may fail or lose the file
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- node.SaveRoutingTable()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	saved, err := loadRoutingTable(cfg.RoutingTablePath, cfg.KeySpace)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Contacts, len(node.RoutingTable.Contacts()))
+}
+
+func Test_Persist_NoPath(t *testing.T) {
+	node, _ := InitNode(false, "localhost:8000", "localhost:9000")
+	assert.NoError(t, node.SaveRoutingTable())
+	assert.Empty(t, node.restored)
+}
+
+func Test_Persist_LoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	saved, err := loadRoutingTable(filepath.Join(dir, "missing.json"), SHA1KeySpace)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	assert.NoError(t, os.WriteFile(corrupt, []byte("{"), 0o644))
+	_, err = loadRoutingTable(corrupt, SHA1KeySpace)
+	assert.Error(t, err)
+
+	// A table saved by a node of another key space is ignored, the node starts afresh
+	cfg := defaultConfig()
+	WithRoutingTablePath(filepath.Join(dir, "routingtable.json"))(cfg)
+	node, _ := newNode(false, "localhost:8000", "localhost:9000", cfg)
+	assert.NoError(t, node.SaveRoutingTable())
+	_, err = loadRoutingTable(cfg.RoutingTablePath, SHA256KeySpace)
+	assert.Error(t, err)
+
+	WithKeySpace(SHA256KeySpace)(cfg)
+	restarted, _ := newNode(false, "localhost:8000", "localhost:9000", cfg)
+	assert.Len(t, *restarted.Id, 32)
+	assert.Empty(t, restarted.restored)
+}
+
+func Test_Persist_LoadPublisherKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "publisher.key")
+
+	// The key is created on first use and the same key is loaded after a restart
+	created, err := LoadPublisherKey(path)
+	assert.NoError(t, err)
+	loaded, err := LoadPublisherKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, created, loaded)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	assert.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	_, err = LoadPublisherKey(path)
+	assert.Error(t, err)
+}
+
+func Test_Persist_RejoinWithoutBootstrap(t *testing.T) {
+	registry := NewMockRegistry()
+	mock := func(cfg *KademliaConfig) {
+		cfg.isMockNetwork = true
+		cfg.MockNetworkRegistry = registry
+	}
+	bootstrapAddr := "127.0.0.1:5240"
+	bootstrap, err := InitKademlia("5240", true, bootstrapAddr, mock)
+	assert.NoError(t, err)
+	peer, err := InitKademlia("5241", false, bootstrapAddr, mock)
+	assert.NoError(t, err)
+	t.Cleanup(peer.Node.Stop)
+
+	path := filepath.Join(t.TempDir(), "routingtable.json")
+	leaving, err := InitKademlia("5242", false, bootstrapAddr, mock, WithRoutingTablePath(path))
+	assert.NoError(t, err)
+	assert.NoError(t, leaving.Leave())
+	assert.NoError(t, bootstrap.Leave())
+
+	restarted, err := InitKademlia("5242", false, bootstrapAddr, mock, WithRoutingTablePath(path))
+	assert.NoError(t, err)
+	t.Cleanup(restarted.Node.Stop)
+	assert.True(t, restarted.Node.Id.Equals(leaving.Node.Id))
+	_, ok := restarted.Node.RoutingTable.Liveness(peer.Node.Id)
+	assert.True(t, ok)
+
+	data := []byte("rejoined")
+	_, err = restarted.Node.Publish(data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, peer.Node.LookupData(NewKademliaIDFromData(data).String()))
+}
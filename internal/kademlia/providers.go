@@ -0,0 +1,204 @@
+package kademlia
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Providers let many nodes register under one key, the way BitTorrent peers announce themselves
+// under an infohash. Unlike values, an ANNOUNCE adds the sender to the set of providers kept for
+// the key instead of replacing what is stored there, and every provider expires on its own
+
+const maxProvidersPerKey = 100
+
+// Provider is a contact that announced itself under a key
+type Provider struct {
+	Contact   Contact
+	ExpiresAt time.Time
+}
+
+// providerTable holds the provider sets a node keeps, by key and by provider ID
+type providerTable struct {
+	sets map[string]map[string]Provider
+	mu   sync.Mutex
+}
+
+func newProviderTable() *providerTable {
+	return &providerTable{sets: make(map[string]map[string]Provider)}
+}
+
+// AddProvider adds contact to the providers of key for ttl, refreshing it if it is already there.
+// When the set is full the provider closest to expiry makes room
+func (node *Node) AddProvider(key string, contact Contact, ttl time.Duration) error {
+	if _, err := node.config.KeySpace.Parse(key); err != nil {
+		return err
+	}
+	if contact.ID == nil {
+		return fmt.Errorf("provider without ID")
+	}
+	if ttl <= 0 {
+		ttl = node.config.ValueTTL
+	}
+
+	table := node.providers
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	set, ok := table.sets[key]
+	if !ok {
+		set = make(map[string]Provider)
+		table.sets[key] = set
+	}
+	id := contact.ID.String()
+	if _, ok := set[id]; !ok && len(set) >= maxProvidersPerKey {
+		var oldest string
+		for other, provider := range set {
+			if oldest == "" || provider.ExpiresAt.Before(set[oldest].ExpiresAt) {
+				oldest = other
+			}
+		}
+		delete(set, oldest)
+	}
+	contact.distance = nil
+	set[id] = Provider{Contact: contact, ExpiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// LookupProviders returns the unexpired providers this node keeps for key
+func (node *Node) LookupProviders(key string) []Contact {
+	table := node.providers
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	now := time.Now()
+	var contacts []Contact
+	for _, provider := range table.sets[key] {
+		if now.Before(provider.ExpiresAt) {
+			contacts = append(contacts, provider.Contact)
+		}
+	}
+	return contacts
+}
+
+// fitProviders drops providers from a GET_PROVIDERS reply at random until it fits in a single
+// datagram. A full provider set does not, and a cut off reply cannot be decoded at all
+func fitProviders(resp RPCMessage) RPCMessage {
+	contacts := resp.Payload.Contacts
+	rand.Shuffle(len(contacts), func(i, j int) { contacts[i], contacts[j] = contacts[j], contacts[i] })
+	for len(contacts) > 0 {
+		resp.Payload.Contacts = contacts
+		data, err := json.Marshal(resp)
+		if err != nil || len(data) <= maxPacketSize {
+			break
+		}
+		// Drop about as many providers as the excess takes up, at least one
+		perContact := len(data) / len(contacts)
+		drop := min((len(data)-maxPacketSize)/perContact+1, len(contacts))
+		contacts = contacts[:len(contacts)-drop]
+	}
+	resp.Payload.Contacts = contacts
+	return resp
+}
+
+// purgeProviders forgets every expired provider and returns how many were removed
+func (node *Node) purgeProviders(now time.Time) int {
+	table := node.providers
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	removed := 0
+	for key, set := range table.sets {
+		for id, provider := range set {
+			if !now.Before(provider.ExpiresAt) {
+				delete(set, id)
+				removed++
+			}
+		}
+		if len(set) == 0 {
+			delete(table.sets, key)
+		}
+	}
+	return removed
+}
+
+// SendAnnounceMessage announces this node as a provider of key at the nodes closest to it,
+// asking them to keep the announcement for ttl. Returns the number of nodes that accepted it
+func (client *Client) SendAnnounceMessage(key string, ttl time.Duration) (int, error) {
+	keyID, err := client.config.KeySpace.Parse(key)
+	if err != nil {
+		return 0, err
+	}
+	closest, err := client.node.IterativeFindNode(keyID)
+	if err != nil || len(closest) == 0 {
+		return 0, fmt.Errorf("no nodes found to announce to")
+	}
+
+	accepted := 0
+	for _, contact := range closest {
+		request := NewRPCMessage("ANNOUNCE", Payload{Key: keyID.String(), TTL: int64(ttl / time.Second)}, true)
+		respChan, err := client.SendMessage(contact, request)
+		if err != nil {
+			continue
+		}
+		resp, ok := client.await(contact, respChan, 2*time.Second)
+		if !ok {
+			log.Println("ANNOUNCE Timeout for contact", contact.String())
+			continue
+		}
+		if resp.Payload.Error != "" {
+			log.Printf("ANNOUNCE refused by %s: %s\n", contact.String(), resp.Payload.Error)
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		return 0, fmt.Errorf("announcement could not be stored on any nodes")
+	}
+	return accepted, nil
+}
+
+// SendGetProvidersMessage asks every node closest to key for its providers of key and returns
+// the merged set, without duplicates
+func (client *Client) SendGetProvidersMessage(key string) ([]Contact, error) {
+	keyID, err := client.config.KeySpace.Parse(key)
+	if err != nil {
+		return nil, err
+	}
+	closest, err := client.node.IterativeFindNode(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var providers []Contact
+	merge := func(contacts []Contact) {
+		for _, contact := range contacts {
+			if contact.ID == nil || seen[contact.ID.String()] {
+				continue
+			}
+			seen[contact.ID.String()] = true
+			providers = append(providers, contact)
+		}
+	}
+
+	answered := 0
+	for _, contact := range closest {
+		request := NewRPCMessage("GET_PROVIDERS", Payload{Key: keyID.String()}, true)
+		respChan, err := client.SendMessage(contact, request)
+		if err != nil {
+			continue
+		}
+		resp, ok := client.await(contact, respChan, 2*time.Second)
+		if !ok {
+			log.Println("GET_PROVIDERS Timeout for contact", contact.String())
+			continue
+		}
+		answered++
+		merge(resp.Payload.Contacts)
+	}
+	if answered == 0 {
+		return nil, fmt.Errorf("GET_PROVIDERS got no answer from any contacted node")
+	}
+	return providers, nil
+}
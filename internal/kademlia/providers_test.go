@@ -0,0 +1,73 @@
+package kademlia
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Providers_AddLookup(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := NewKademliaIDFromData([]byte("infohash")).String()
+	first := Contact{ID: NewKademliaID("1111111111111111111111111111111111111111"), Address: "1.2.3.4:1"}
+	second := Contact{ID: NewKademliaID("2222222222222222222222222222222222222222"), Address: "1.2.3.4:2"}
+
+	// Announcing adds to the set instead of replacing it
+	assert.NoError(t, node.AddProvider(key, first, time.Hour))
+	assert.NoError(t, node.AddProvider(key, second, time.Hour))
+	assert.NoError(t, node.AddProvider(key, first, time.Hour))
+	assert.ElementsMatch(t, []Contact{first, second}, node.LookupProviders(key))
+
+	assert.Error(t, node.AddProvider("not a key", first, time.Hour))
+	assert.Error(t, node.AddProvider(SHA256KeySpace.Sum([]byte("infohash")).String(), first, time.Hour))
+	assert.Error(t, node.AddProvider(key, Contact{Address: "1.2.3.4:3"}, time.Hour))
+}
+
+func Test_Providers_Expire(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := NewKademliaIDFromData([]byte("infohash")).String()
+	contact := Contact{ID: NewKademliaID("1111111111111111111111111111111111111111"), Address: "1.2.3.4:1"}
+	assert.NoError(t, node.AddProvider(key, contact, time.Millisecond))
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, node.LookupProviders(key))
+	assert.Equal(t, 1, node.purgeProviders(time.Now()))
+	assert.Empty(t, node.providers.sets)
+}
+
+func Test_Providers_Limit(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := NewKademliaIDFromData([]byte("infohash")).String()
+	for i := range maxProvidersPerKey + 5 {
+		contact := Contact{ID: NewKademliaID(fmt.Sprintf("%040x", i+1)), Address: fmt.Sprintf("1.2.3.4:%d", i)}
+		assert.NoError(t, node.AddProvider(key, contact, time.Hour+time.Duration(i)*time.Second))
+	}
+	providers := node.LookupProviders(key)
+	assert.Len(t, providers, maxProvidersPerKey)
+	assert.NotContains(t, providers, Contact{ID: NewKademliaID(fmt.Sprintf("%040x", 1)), Address: "1.2.3.4:0"})
+}
+
+func Test_Providers_AnnounceGetProviders(t *testing.T) {
+	nodes := newMockCluster(t, 5200, 5)
+	key := NewKademliaIDFromData([]byte("infohash")).String()
+
+	for _, node := range nodes[1:4] {
+		accepted, err := node.Client.SendAnnounceMessage(key, time.Hour)
+		assert.NoError(t, err)
+		assert.Positive(t, accepted)
+	}
+
+	providers, err := nodes[4].Client.SendGetProvidersMessage(key)
+	assert.NoError(t, err)
+	var addresses []string
+	for _, provider := range providers {
+		addresses = append(addresses, provider.Address)
+	}
+	assert.ElementsMatch(t, []string{
+		nodes[1].Node.GetSelfContact().Address,
+		nodes[2].Node.GetSelfContact().Address,
+		nodes[3].Node.GetSelfContact().Address,
+	}, addresses)
+}
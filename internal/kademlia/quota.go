@@ -0,0 +1,269 @@
+package kademlia
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStorageFull   = errors.New("storage full")
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// EvictionCandidate describes a stored value as seen by an EvictionPolicy
+type EvictionCandidate struct {
+	Key        string
+	Size       int
+	StoredAt   time.Time
+	AccessedAt time.Time
+}
+
+// EvictionPolicy chooses which stored value to give up when a STORE does not fit in the storage limit
+type EvictionPolicy interface {
+	// Victim returns the key of the candidate to evict to make room for incoming,
+	// or false if incoming should be refused instead
+	Victim(self *KademliaID, incoming EvictionCandidate, candidates []EvictionCandidate) (string, bool)
+}
+
+// FarthestFirstEviction evicts the value whose key is farthest from the node's own ID,
+// since the node is the least likely to be one of the k closest nodes for it.
+// A value that is farther away than every stored value is refused instead
+type FarthestFirstEviction struct{}
+
+func (FarthestFirstEviction) Victim(self *KademliaID, incoming EvictionCandidate, candidates []EvictionCandidate) (string, bool) {
+	var victim string
+	var victimDistance *KademliaID
+	for _, c := range candidates {
+		distance := keyDistance(self, c.Key)
+		if victimDistance == nil || victimDistance.Less(distance) {
+			victim, victimDistance = c.Key, distance
+		}
+	}
+	if victimDistance == nil || victimDistance.Less(keyDistance(self, incoming.Key)) {
+		return "", false
+	}
+	return victim, true
+}
+
+// LRUEviction evicts the value that was least recently read or stored
+type LRUEviction struct{}
+
+func (LRUEviction) Victim(self *KademliaID, incoming EvictionCandidate, candidates []EvictionCandidate) (string, bool) {
+	var victim *EvictionCandidate
+	for i := range candidates {
+		if victim == nil || candidates[i].AccessedAt.Before(victim.AccessedAt) {
+			victim = &candidates[i]
+		}
+	}
+	if victim == nil {
+		return "", false
+	}
+	return victim.Key, true
+}
+
+// keyDistance returns the distance between self and key, treating keys that are not IDs as farthest
+func keyDistance(self *KademliaID, key string) *KademliaID {
+	id, err := ParseKademliaID(key)
+	if err != nil {
+		farthest := make(KademliaID, len(*self))
+		for i := range farthest {
+			farthest[i] = 0xff
+		}
+		return &farthest
+	}
+	return self.CalcDistance(id)
+}
+
+// usageEntry is the bookkeeping kept for one stored value
+type usageEntry struct {
+	size       int
+	source     string
+	storedAt   time.Time
+	accessedAt time.Time
+	publisher  bool
+	tombstone  bool
+}
+
+// storageUsage tracks the bytes held per key and per source contact to enforce the storage limits.
+// It is built from the storage on first use and kept up to date by the node afterwards
+type storageUsage struct {
+	entries  map[string]*usageEntry
+	total    int
+	bySource map[string]int
+	loaded   bool
+	mu       sync.Mutex
+}
+
+func newStorageUsage() *storageUsage {
+	return &storageUsage{}
+}
+
+// load rebuilds the usage from storage if needed, callers must hold u.mu
+func (u *storageUsage) load(storage Storage) {
+	if u.loaded {
+		return
+	}
+	u.entries = make(map[string]*usageEntry)
+	u.bySource = make(map[string]int)
+	u.total = 0
+	storage.ForEach(func(key string, record Record) bool {
+		u.add(key, record)
+		return true
+	})
+	u.loaded = true
+}
+
+// add records a stored value, replacing any previous entry for key, callers must hold u.mu
+func (u *storageUsage) add(key string, record Record) {
+	u.remove(key)
+	entry := &usageEntry{
+		size:       recordSize(record),
+		source:     sourceKey(record.Source),
+		storedAt:   record.StoredAt,
+		accessedAt: record.StoredAt,
+		publisher:  record.Publisher,
+		tombstone:  record.Tombstone,
+	}
+	u.entries[key] = entry
+	u.total += entry.size
+	u.bySource[entry.source] += entry.size
+}
+
+// remove forgets a stored value, callers must hold u.mu
+func (u *storageUsage) remove(key string) {
+	entry, ok := u.entries[key]
+	if !ok {
+		return
+	}
+	delete(u.entries, key)
+	u.total -= entry.size
+	u.bySource[entry.source] -= entry.size
+	if u.bySource[entry.source] <= 0 {
+		delete(u.bySource, entry.source)
+	}
+}
+
+// recordSize returns the number of value bytes a record takes up, counting every sibling
+func recordSize(record Record) int {
+	size := len(record.Data)
+	for _, sibling := range record.Siblings {
+		size += len(sibling.Data)
+	}
+	return size
+}
+
+// sourceKey identifies the contact a value was received from
+func sourceKey(source Contact) string {
+	if source.ID != nil {
+		return source.ID.String()
+	}
+	return source.Address
+}
+
+// limited reports whether the node enforces any storage limit
+func (node *Node) limited() bool {
+	return node.config.StorageByteLimit > 0 || node.config.SourceByteQuota > 0
+}
+
+// reserve makes room for record under key, evicting other values if the policy allows it.
+// Publisher copies and tombstones are never evicted.
+// Callers must hold node.usage.mu and keep holding it until the record is written
+func (node *Node) reserve(key string, record Record) error {
+	usage := node.usage
+	usage.load(node.Storage)
+
+	size := recordSize(record)
+	replaced := 0
+	if old, ok := usage.entries[key]; ok {
+		replaced = old.size
+	}
+
+	if quota := node.config.SourceByteQuota; quota > 0 && !record.Publisher {
+		source := sourceKey(record.Source)
+		used := usage.bySource[source]
+		if old, ok := usage.entries[key]; ok && old.source == source {
+			used -= old.size
+		}
+		if used+size > quota {
+			return fmt.Errorf("%w: %s would use %d of %d bytes", ErrQuotaExceeded, source, used+size, quota)
+		}
+	}
+
+	limit := node.config.StorageByteLimit
+	if limit <= 0 {
+		return nil
+	}
+	if size > limit {
+		return fmt.Errorf("%w: value of %d bytes exceeds limit of %d bytes", ErrStorageFull, size, limit)
+	}
+
+	incoming := EvictionCandidate{Key: key, Size: size, StoredAt: record.StoredAt, AccessedAt: record.StoredAt}
+	for usage.total-replaced+size > limit {
+		var candidates []EvictionCandidate
+		for k, entry := range usage.entries {
+			// Dropping a tombstone would let the deleted value be stored again
+			if entry.publisher || entry.tombstone || k == key {
+				continue
+			}
+			candidates = append(candidates, EvictionCandidate{Key: k, Size: entry.size, StoredAt: entry.storedAt, AccessedAt: entry.accessedAt})
+		}
+		victim, ok := node.config.EvictionPolicy.Victim(node.Id, incoming, candidates)
+		if !ok {
+			return fmt.Errorf("%w: %d of %d bytes in use", ErrStorageFull, usage.total, limit)
+		}
+		if err := node.Storage.Delete(victim); err != nil {
+			return fmt.Errorf("failed to evict %s: %w", victim, err)
+		}
+		usage.remove(victim)
+	}
+	return nil
+}
+
+// touch marks key as accessed for LRU eviction
+func (node *Node) touch(key string) {
+	if !node.limited() {
+		return
+	}
+	node.usage.mu.Lock()
+	defer node.usage.mu.Unlock()
+	if entry, ok := node.usage.entries[key]; ok {
+		entry.accessedAt = time.Now()
+	}
+}
+
+// deleteExpired removes key from storage and from the usage bookkeeping if its record has expired
+// by now. The record is read again under storeMu, so one refreshed by a concurrent STORE since
+// the caller found it expired is kept. Reports whether it was removed
+func (node *Node) deleteExpired(key string, now time.Time) (bool, error) {
+	node.storeMu.Lock()
+	defer node.storeMu.Unlock()
+	record, ok := node.Storage.Get(key)
+	if !ok || !record.Expired(now) {
+		return false, nil
+	}
+	return true, node.removeLocked(key)
+}
+
+// removeLocked removes key from storage and from the usage bookkeeping, callers must hold node.storeMu
+func (node *Node) removeLocked(key string) error {
+	node.usage.mu.Lock()
+	defer node.usage.mu.Unlock()
+	if node.usage.loaded {
+		node.usage.remove(key)
+	}
+	return node.Storage.Delete(key)
+}
+
+// StorageUsage returns the number of bytes stored on behalf of each source contact
+func (node *Node) StorageUsage() map[string]int {
+	node.usage.mu.Lock()
+	defer node.usage.mu.Unlock()
+	node.usage.load(node.Storage)
+	usage := make(map[string]int, len(node.usage.bySource))
+	for source, bytes := range node.usage.bySource {
+		usage[source] = bytes
+	}
+	return usage
+}
@@ -0,0 +1,149 @@
+package kademlia
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLimitedNode(limit int, quota int, policy EvictionPolicy) *Node {
+	cfg := defaultConfig()
+	cfg.StorageByteLimit = limit
+	cfg.SourceByteQuota = quota
+	cfg.EvictionPolicy = policy
+	node, _ := newNode(true, "localhost:8000", "", cfg)
+	return node
+}
+
+func Test_Quota_SourceQuota(t *testing.T) {
+	node := newLimitedNode(0, 10, FarthestFirstEviction{})
+	alice := NewContact(NewKademliaID("1111111111111111111111111111111111111111"), "alice")
+	bob := NewContact(NewKademliaID("2222222222222222222222222222222222222222"), "bob")
+
+	assert.NoError(t, node.Store("a1", Record{Data: []byte("12345678"), Source: alice}))
+	err := node.Store("a2", Record{Data: []byte("123"), Source: alice})
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	// Replacing one of your own values only counts the difference
+	assert.NoError(t, node.Store("a1", Record{Data: []byte("1234567890"), Source: alice}))
+	// Other contacts have their own quota
+	assert.NoError(t, node.Store("b1", Record{Data: []byte("123"), Source: bob}))
+
+	assert.Equal(t, map[string]int{alice.ID.String(): 10, bob.ID.String(): 3}, node.StorageUsage())
+}
+
+func Test_Quota_FarthestFirst(t *testing.T) {
+	node := newLimitedNode(8, 0, FarthestFirstEviction{})
+	near := "0000000000000000000000000000000000000001"
+	far := "f000000000000000000000000000000000000000"
+	mid := "0f00000000000000000000000000000000000000"
+
+	assert.NoError(t, node.Store(near, Record{Data: []byte("1234")}))
+	assert.NoError(t, node.Store(far, Record{Data: []byte("1234")}))
+	// Full, the farthest value makes room for a closer one
+	assert.NoError(t, node.Store(mid, Record{Data: []byte("1234")}))
+	assert.Nil(t, node.LookupData(far))
+	assert.NotNil(t, node.LookupData(near))
+	assert.NotNil(t, node.LookupData(mid))
+
+	// A value farther than anything stored is refused
+	err := node.Store(far, Record{Data: []byte("1234")})
+	assert.ErrorIs(t, err, ErrStorageFull)
+
+	// A value larger than the whole budget is refused
+	err = node.Store(near, Record{Data: []byte("123456789")})
+	assert.ErrorIs(t, err, ErrStorageFull)
+}
+
+func Test_Quota_LRU(t *testing.T) {
+	node := newLimitedNode(8, 0, LRUEviction{})
+	assert.NoError(t, node.Store("a", Record{Data: []byte("1234")}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, node.Store("b", Record{Data: []byte("1234")}))
+	time.Sleep(time.Millisecond)
+	node.LookupData("a")
+
+	assert.NoError(t, node.Store("c", Record{Data: []byte("1234")}))
+	assert.NotNil(t, node.LookupData("a"))
+	assert.Nil(t, node.LookupData("b"))
+	assert.NotNil(t, node.LookupData("c"))
+}
+
+func Test_Quota_PublisherNotEvicted(t *testing.T) {
+	node := newLimitedNode(4, 0, LRUEviction{})
+	assert.NoError(t, node.Store("mine", Record{Data: []byte("1234"), Publisher: true}))
+	err := node.Store("other", Record{Data: []byte("1")})
+	assert.ErrorIs(t, err, ErrStorageFull)
+	assert.NotNil(t, node.LookupData("mine"))
+}
+
+func Test_Quota_TombstoneNotEvicted(t *testing.T) {
+	node := newLimitedNode(4, 0, LRUEviction{})
+	assert.NoError(t, node.Store("gone", Record{Tombstone: true}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, node.Store("a", Record{Data: []byte("1234")}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, node.Store("b", Record{Data: []byte("1234")}))
+
+	record, ok := node.LookupRecord("gone")
+	assert.True(t, ok)
+	assert.True(t, record.Tombstone)
+	assert.Nil(t, node.LookupData("a"))
+}
+
+func Test_Quota_UsageWithoutLimit(t *testing.T) {
+	node := newLimitedNode(0, 0, FarthestFirstEviction{})
+	source := NewContact(NewKademliaID("1111111111111111111111111111111111111111"), "source")
+	assert.NoError(t, node.Store("a", Record{Data: []byte("1234"), Source: source}))
+	assert.Equal(t, map[string]int{source.ID.String(): 4}, node.StorageUsage())
+
+	// Stores and expiries after the first call are still counted
+	assert.NoError(t, node.Store("b", Record{Data: []byte("12"), Source: source}))
+	assert.Equal(t, map[string]int{source.ID.String(): 6}, node.StorageUsage())
+	assert.NoError(t, node.Store("a", Record{Data: []byte("1234"), Source: source, ExpiresAt: time.Now().Add(-time.Second)}))
+	node.PurgeExpired()
+	assert.Equal(t, map[string]int{source.ID.String(): 2}, node.StorageUsage())
+}
+
+func Test_Quota_LoadsExistingStorage(t *testing.T) {
+	node := newLimitedNode(8, 0, LRUEviction{})
+	storage := NewMemoryStorage()
+	storage.Put("existing", Record{Data: []byte("12345678")})
+	node.SetStorage(storage)
+
+	assert.NoError(t, node.Store("new", Record{Data: []byte("1234")}))
+	_, ok := storage.Get("existing")
+	assert.False(t, ok)
+}
+
+func Test_Quota_PurgeExpiredUpdatesUsage(t *testing.T) {
+	node := newLimitedNode(0, 4, FarthestFirstEviction{})
+	source := NewContact(NewKademliaID("1111111111111111111111111111111111111111"), "source")
+	assert.NoError(t, node.Store("old", Record{Data: []byte("1234"), Source: source, ExpiresAt: time.Now().Add(-time.Second)}))
+	node.PurgeExpired()
+	assert.NoError(t, node.Store("new", Record{Data: []byte("1234"), Source: source}))
+}
+
+func Test_Server_ProcessRequest_STORE_Refused(t *testing.T) {
+	port := "4327"
+	node := newLimitedNode(1, 0, FarthestFirstEviction{})
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9993"
+	registry.Register(addr)
+	key := NewKademliaIDFromData([]byte("value")).String()
+	rpc := NewRPCMessage("STORE", Payload{Key: key, Data: []byte("value"), SourceContact: node.GetSelfContact()}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, _ := registry.Get(addr)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Contains(t, outRPC.Payload.Error, ErrStorageFull.Error())
+	case <-time.After(1 * time.Second):
+		t.Error("No STORE response received")
+	}
+}
@@ -0,0 +1,181 @@
+package kademlia
+
+import (
+	"fmt"
+)
+
+// Reed-Solomon erasure coding over GF(2^8). The first m shards hold the data itself and the
+// remaining n-m shards are parity rows of a Cauchy matrix, so any m of the n shards are enough
+// to reconstruct the data
+
+const maxShards = 256
+
+var gfExp [512]byte
+var gfLog [256]byte
+
+func init() {
+	// Generator 2 of GF(2^8) with the reducing polynomial x^8 + x^4 + x^3 + x^2 + 1
+	x := 1
+	for i := range 255 {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// erasureRow returns the coefficients that produce shard i from the m data shards
+func erasureRow(i int, m int) []byte {
+	row := make([]byte, m)
+	if i < m {
+		row[i] = 1
+		return row
+	}
+	// Cauchy matrix 1/(x_i + y_j) with x_i = i and y_j = j, which are distinct since i >= m > j
+	for j := range m {
+		row[j] = gfInv(byte(i) ^ byte(j))
+	}
+	return row
+}
+
+// erasureEncode splits data into m equally sized data shards, padding the last one with zeros,
+// and computes n-m parity shards from them
+func erasureEncode(data []byte, n int, m int) ([][]byte, error) {
+	if err := checkErasureParams(n, m); err != nil {
+		return nil, err
+	}
+	size := max((len(data)+m-1)/m, 1)
+	padded := make([]byte, size*m)
+	copy(padded, data)
+
+	shards := make([][]byte, n)
+	for i := range m {
+		shards[i] = padded[i*size : (i+1)*size]
+	}
+	for i := m; i < n; i++ {
+		shards[i] = make([]byte, size)
+		for j, coefficient := range erasureRow(i, m) {
+			for b := range size {
+				shards[i][b] ^= gfMul(coefficient, shards[j][b])
+			}
+		}
+	}
+	return shards, nil
+}
+
+// erasureDecode reconstructs the original size bytes from any m shards, given by shard index
+func erasureDecode(shards map[int][]byte, n int, m int, size int) ([]byte, error) {
+	if err := checkErasureParams(n, m); err != nil {
+		return nil, err
+	}
+	if len(shards) < m {
+		return nil, fmt.Errorf("need %d shards to reconstruct, have %d", m, len(shards))
+	}
+
+	indexes := make([]int, 0, m)
+	shardSize := -1
+	for i := range n {
+		shard, ok := shards[i]
+		if !ok || len(indexes) == m {
+			continue
+		}
+		if shardSize >= 0 && len(shard) != shardSize {
+			return nil, fmt.Errorf("shard %d has %d bytes, expected %d", i, len(shard), shardSize)
+		}
+		shardSize = len(shard)
+		indexes = append(indexes, i)
+	}
+	if shardSize*m < size {
+		return nil, fmt.Errorf("shards hold %d bytes, expected at least %d", shardSize*m, size)
+	}
+
+	// Invert the rows of the encoding matrix belonging to the shards we have
+	matrix := make([][]byte, m)
+	for r, i := range indexes {
+		matrix[r] = erasureRow(i, m)
+	}
+	inverse, err := gfInvertMatrix(matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, shardSize*m)
+	for j := range m {
+		out := data[j*shardSize : (j+1)*shardSize]
+		for r, i := range indexes {
+			coefficient := inverse[j][r]
+			if coefficient == 0 {
+				continue
+			}
+			for b, v := range shards[i] {
+				out[b] ^= gfMul(coefficient, v)
+			}
+		}
+	}
+	return data[:size], nil
+}
+
+// gfInvertMatrix inverts a square matrix over GF(2^8) by Gauss-Jordan elimination
+func gfInvertMatrix(matrix [][]byte) ([][]byte, error) {
+	size := len(matrix)
+	work := make([][]byte, size)
+	for r := range size {
+		work[r] = make([]byte, 2*size)
+		copy(work[r], matrix[r])
+		work[r][size+r] = 1
+	}
+
+	for col := range size {
+		pivot := col
+		for pivot < size && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == size {
+			return nil, fmt.Errorf("erasure matrix is singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInv(work[col][col])
+		for c := range work[col] {
+			work[col][c] = gfMul(work[col][c], scale)
+		}
+		for r := range size {
+			if r == col || work[r][col] == 0 {
+				continue
+			}
+			factor := work[r][col]
+			for c := range work[r] {
+				work[r][c] ^= gfMul(factor, work[col][c])
+			}
+		}
+	}
+
+	inverse := make([][]byte, size)
+	for r := range size {
+		inverse[r] = work[r][size:]
+	}
+	return inverse, nil
+}
+
+func checkErasureParams(n int, m int) error {
+	if m < 1 || n < m || n > maxShards {
+		return fmt.Errorf("invalid erasure coding %d/%d: need 1 <= m <= n <= %d", n, m, maxShards)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package kademlia
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReedSolomon_ReconstructFromAnyShards(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.Read(data)
+	n, m := 6, 4
+
+	shards, err := erasureEncode(data, n, m)
+	assert.NoError(t, err)
+	assert.Len(t, shards, n)
+	assert.Equal(t, data[:250], shards[0])
+
+	// Every combination of m shards reconstructs the data
+	for mask := 0; mask < 1<<n; mask++ {
+		subset := make(map[int][]byte)
+		for i := range n {
+			if mask&(1<<i) != 0 {
+				subset[i] = shards[i]
+			}
+		}
+		if len(subset) != m {
+			continue
+		}
+		result, err := erasureDecode(subset, n, m, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, result)
+	}
+}
+
+func Test_ReedSolomon_TooFewShards(t *testing.T) {
+	shards, _ := erasureEncode([]byte("some value"), 5, 3)
+	_, err := erasureDecode(map[int][]byte{0: shards[0], 4: shards[4]}, 5, 3, 10)
+	assert.Error(t, err)
+}
+
+func Test_ReedSolomon_InvalidParams(t *testing.T) {
+	_, err := erasureEncode([]byte("value"), 2, 3)
+	assert.Error(t, err)
+	_, err = erasureEncode([]byte("value"), 300, 3)
+	assert.Error(t, err)
+	_, err = erasureEncode([]byte("value"), 3, 0)
+	assert.Error(t, err)
+}
+
+func Test_ReedSolomon_GaloisField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), gfMul(byte(a), gfInv(byte(a))))
+	}
+	assert.Equal(t, byte(0), gfMul(0, 7))
+}
@@ -0,0 +1,97 @@
+package kademlia
+
+import (
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Buckets are refreshed the way the Kademlia paper describes: every node lookup marks the bucket
+// its target falls in as looked up, and a bucket that has not been looked up for RefreshInterval
+// is refreshed with a lookup of a random ID in its range. That keeps contacts in quiet regions of
+// the key space fresh and fills buckets that lookups never pass through
+
+// markLookup records that a node lookup was done for target
+func (routingTable *RoutingTable) markLookup(target *KademliaID, now time.Time) {
+	if !routingTable.accepts(target) {
+		return
+	}
+	bucket := routingTable.buckets[routingTable.getBucketIndex(target)]
+	bucket.mu.Lock()
+	bucket.lookedUpAt = now
+	bucket.mu.Unlock()
+}
+
+// idleBuckets returns the indexes of the buckets that have not been looked up since before
+func (routingTable *RoutingTable) idleBuckets(before time.Time) []int {
+	var idle []int
+	for i, bucket := range routingTable.buckets {
+		bucket.mu.RLock()
+		if bucket.lookedUpAt.Before(before) {
+			idle = append(idle, i)
+		}
+		bucket.mu.RUnlock()
+	}
+	return idle
+}
+
+// randomIDInBucket returns a random ID that falls in bucket index of the routing table,
+// i.e. that shares exactly index leading bits with this node's ID
+func (routingTable *RoutingTable) randomIDInBucket(index int) *KademliaID {
+	me := *routingTable.me.ID
+	id := make(KademliaID, len(me))
+	for i := range id {
+		id[i] = uint8(rand.Intn(256))
+	}
+	for bit := 0; bit <= index && bit < len(me)*8; bit++ {
+		mask := uint8(0x80) >> (bit % 8)
+		if (me[bit/8]&mask != 0) != (bit == index) {
+			id[bit/8] |= mask
+		} else {
+			id[bit/8] &^= mask
+		}
+	}
+	return &id
+}
+
+// RefreshBuckets looks up a random ID in every bucket that has not been looked up within
+// RefreshInterval. Returns the number of buckets refreshed
+func (node *Node) RefreshBuckets() int {
+	idle := node.RoutingTable.idleBuckets(time.Now().Add(-node.config.RefreshInterval))
+	return node.refreshBuckets(idle)
+}
+
+// refreshAfterJoin refreshes every bucket farther away than the closest neighbour found when
+// joining, as the paper does, so a new node learns about every region of the key space at once.
+// The buckets closer than that neighbour are empty and have no contacts to look for
+func (node *Node) refreshAfterJoin() int {
+	// The routing table can hold this node's own contact, which is not a neighbour
+	for _, contact := range node.RoutingTable.FindClosestContacts(node.Id, 2) {
+		if contact.ID.Equals(node.Id) {
+			continue
+		}
+		var farther []int
+		for i := range node.RoutingTable.getBucketIndex(contact.ID) {
+			farther = append(farther, i)
+		}
+		return node.refreshBuckets(farther)
+	}
+	return 0
+}
+
+func (node *Node) refreshBuckets(indexes []int) int {
+	refreshed := 0
+	for _, index := range indexes {
+		select {
+		case <-node.done:
+			return refreshed
+		default:
+		}
+		if _, err := node.IterativeFindNode(node.RoutingTable.randomIDInBucket(index)); err != nil {
+			log.Printf("failed to refresh bucket %d: %v\n", index, err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed
+}
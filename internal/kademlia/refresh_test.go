@@ -0,0 +1,57 @@
+package kademlia
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Refresh_randomIDInBucket(t *testing.T) {
+	for _, keySpace := range []KeySpace{SHA1KeySpace, SHA256KeySpace} {
+		rt := NewRoutingTable(Contact{ID: keySpace.RandomID(), Address: "localhost:8000"})
+		for _, index := range []int{0, 1, 7, 8, 100, keySpace.Bits() - 2} {
+			id := rt.randomIDInBucket(index)
+			assert.Equal(t, index, rt.getBucketIndex(id), "bucket %d of %s", index, keySpace.Name)
+			assert.Equal(t, index, commonPrefixLen(id, rt.me.ID))
+		}
+	}
+}
+
+func Test_Refresh_idleBuckets(t *testing.T) {
+	rt := NewRoutingTable(Contact{ID: NewRandomKademliaID(), Address: "localhost:8000"})
+	assert.Empty(t, rt.idleBuckets(time.Now().Add(-time.Hour)))
+	assert.Len(t, rt.idleBuckets(time.Now().Add(time.Hour)), IDLength*8)
+
+	later := time.Now().Add(time.Minute)
+	rt.markLookup(rt.randomIDInBucket(5), later)
+	idle := rt.idleBuckets(later)
+	assert.Len(t, idle, IDLength*8-1)
+	assert.NotContains(t, idle, 5)
+}
+
+func Test_Refresh_RefreshBuckets(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClient{})
+	node.AddContact(Contact{ID: NewRandomKademliaID(), Address: "localhost:8001"})
+
+	stale := time.Now().Add(-2 * node.config.RefreshInterval)
+	for _, index := range []int{3, 42} {
+		node.RoutingTable.buckets[index].lookedUpAt = stale
+	}
+	assert.Equal(t, 2, node.RefreshBuckets())
+	assert.Equal(t, 0, node.RefreshBuckets())
+}
+
+func Test_Refresh_AfterJoin(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	node.SetClient(&MockClient{})
+	assert.Equal(t, 0, node.refreshAfterJoin())
+
+	// The closest neighbour shares 3 leading bits with the all zero ID, so buckets 0 to 2 are refreshed
+	node.AddContact(Contact{ID: NewKademliaID(fmt.Sprintf("1%039d", 0)), Address: "localhost:8001"})
+	before := time.Now()
+	assert.Equal(t, 3, node.refreshAfterJoin())
+	assert.Len(t, node.RoutingTable.idleBuckets(before), IDLength*8-3)
+}
@@ -4,13 +4,14 @@ import (
 	"sync"
 )
 
+// bucketSize is the default k, the number of contacts per bucket and the replication factor
 const bucketSize = 20
 
 // RoutingTable definition
 // keeps a refrence contact of me and an array of buckets
 type RoutingTable struct {
 	me      Contact
-	buckets [IDLength * 8]*bucket
+	buckets []*bucket // one per bit of the ID width
 	mu      sync.RWMutex
 }
 
@@ -18,11 +19,16 @@ func GetMe(routingTable *RoutingTable) Contact {
 	return routingTable.me
 }
 
-// NewRoutingTable returns a new instance of a RoutingTable
+// NewRoutingTable returns a new instance of a RoutingTable with buckets of the default size
 func NewRoutingTable(me Contact) *RoutingTable {
-	routingTable := &RoutingTable{}
-	for i := 0; i < IDLength*8; i++ {
-		routingTable.buckets[i] = newBucket()
+	return newRoutingTable(me, bucketSize)
+}
+
+// newRoutingTable returns a new instance of a RoutingTable whose buckets hold k contacts
+func newRoutingTable(me Contact, k int) *RoutingTable {
+	routingTable := &RoutingTable{buckets: make([]*bucket, len(*me.ID)*8)}
+	for i := range routingTable.buckets {
+		routingTable.buckets[i] = newBucket(k)
 	}
 	routingTable.me = me
 	return routingTable
@@ -30,6 +36,9 @@ func NewRoutingTable(me Contact) *RoutingTable {
 
 // AddContact add a new contact to the correct Bucket
 func (routingTable *RoutingTable) AddContact(contact Contact) {
+	if !routingTable.accepts(contact.ID) {
+		return
+	}
 	routingTable.mu.Lock()
 	defer routingTable.mu.Unlock()
 
@@ -48,12 +57,12 @@ func (routingTable *RoutingTable) FindClosestContacts(target *KademliaID, count
 	routingTable.mu.RLock()
 	candidates.Append(bucket.GetContactAndCalcDistance(target))
 
-	for i := 1; (bucketIndex-i >= 0 || bucketIndex+i < IDLength*8) && candidates.Len() < count; i++ {
+	for i := 1; (bucketIndex-i >= 0 || bucketIndex+i < len(routingTable.buckets)) && candidates.Len() < count; i++ {
 		if bucketIndex-i >= 0 {
 			bucket = routingTable.buckets[bucketIndex-i]
 			candidates.Append(bucket.GetContactAndCalcDistance(target))
 		}
-		if bucketIndex+i < IDLength*8 {
+		if bucketIndex+i < len(routingTable.buckets) {
 			bucket = routingTable.buckets[bucketIndex+i]
 			candidates.Append(bucket.GetContactAndCalcDistance(target))
 		}
@@ -68,10 +77,15 @@ func (routingTable *RoutingTable) FindClosestContacts(target *KademliaID, count
 	return candidates.GetContacts(count)
 }
 
+// accepts reports whether id has the width of this node's ID, contacts from other key spaces are never added
+func (routingTable *RoutingTable) accepts(id *KademliaID) bool {
+	return id != nil && len(*id) == len(*routingTable.me.ID)
+}
+
 // getBucketIndex get the correct Bucket index for the KademliaID
 func (routingTable *RoutingTable) getBucketIndex(id *KademliaID) int {
-	distance := id.CalcDistance(routingTable.me.ID)
-	for i := 0; i < IDLength; i++ {
+	distance := *id.CalcDistance(routingTable.me.ID)
+	for i := 0; i < len(distance) && i*8 < len(routingTable.buckets); i++ {
 		for j := 0; j < 8; j++ {
 			if (distance[i]>>uint8(7-j))&0x1 != 0 {
 				return i*8 + j
@@ -79,5 +93,5 @@ func (routingTable *RoutingTable) getBucketIndex(id *KademliaID) int {
 		}
 	}
 
-	return IDLength*8 - 1
+	return len(routingTable.buckets) - 1
 }
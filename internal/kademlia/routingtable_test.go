@@ -95,3 +95,16 @@ func Test_routingtable_FindClosestContacts_EmptyTable(t *testing.T) {
 	closest := rt.FindClosestContacts(target, 3)
 	assert.Equal(t, 0, len(closest))
 }
+
+func Test_routingtable_KeySpaceWidth(t *testing.T) {
+	rt := NewRoutingTable(Contact{ID: SHA256KeySpace.RandomID(), Address: "localhost:8000"})
+	assert.Len(t, rt.buckets, 256)
+
+	// Contacts from a network with another ID width are never added
+	rt.AddContact(Contact{ID: SHA1KeySpace.RandomID(), Address: "localhost:8001"})
+	rt.AddContact(Contact{Address: "localhost:8002"})
+	assert.Empty(t, rt.FindClosestContacts(SHA256KeySpace.RandomID(), bucketSize))
+
+	rt.AddContact(Contact{ID: SHA256KeySpace.RandomID(), Address: "localhost:8003"})
+	assert.Len(t, rt.FindClosestContacts(SHA256KeySpace.RandomID(), bucketSize), 1)
+}
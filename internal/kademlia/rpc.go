@@ -6,22 +6,70 @@ import (
 
 // Payload represents the data carried in an RPC message
 type Payload struct {
-	Contacts      []Contact `json:"contacts,omitempty"`
-	SourceContact Contact   `json:"src_contact,omitempty"`
-	TargetContact Contact   `json:"trgt_contact,omitempty"`
-	Key           string    `json:"key,omitempty"`
-	Data          []byte    `json:"data,omitempty"`
-	Error         string    `json:"error,omitempty"`
+	Contacts      []Contact      `json:"contacts,omitempty"`
+	SourceContact Contact        `json:"src_contact,omitempty"`
+	TargetContact Contact        `json:"trgt_contact,omitempty"`
+	Key           string         `json:"key,omitempty"`
+	Data          []byte         `json:"data,omitempty"`
+	TTL           int64          `json:"ttl,omitempty"`   // Seconds a stored or found value should live, 0 lets the receiver decide
+	Cache         bool           `json:"cache,omitempty"` // The STORE is a cached copy from a lookup path
+	PublicKey     []byte         `json:"pub,omitempty"`   // Publisher key of a mutable record
+	Salt          []byte         `json:"salt,omitempty"`
+	Seq           int64          `json:"seq,omitempty"`
+	Signature     []byte         `json:"sig,omitempty"`
+	Tombstone     bool           `json:"tombstone,omitempty"` // The signed record was deleted
+	Owner         []byte         `json:"owner,omitempty"`     // Publisher key of an owned content addressed value
+	Shard         bool           `json:"shard,omitempty"`     // The value is an erasure shard, not replicated to k nodes
+	Name          string         `json:"name,omitempty"`      // Logical name of a versioned value
+	Siblings      []Sibling      `json:"siblings,omitempty"`  // Concurrent values of a versioned value
+	Error         string         `json:"error,omitempty"`
+	Summary       *MerkleSummary `json:"summary,omitempty"` // Reply to SYNC_TREE
 }
 
 // RPCMessage represents a message sent between nodes in the Kademlia network
 type RPCMessage struct {
-	Type     string  `json:"msg"`       // "PING", "STORE", "FIND_NODE", "FIND_VALUE"
+	Type     string  `json:"msg"`       // "PING", "STORE", "FIND_NODE", "FIND_VALUE", "SYNC_TREE", "DELETE", "ANNOUNCE", "GET_PROVIDERS"
 	Payload  Payload `json:"payload"`   // The actual data being sent
 	PacketID string  `json:"packet_id"` // Unique ID for the RPC call
 	Query    bool    `json:"query"`     // Is this message a query (request) or a response
 }
 
+// recordFromPayload returns the value carried by a STORE request or FIND_VALUE response
+func recordFromPayload(payload Payload) Record {
+	return Record{
+		Data:      payload.Data,
+		PublicKey: payload.PublicKey,
+		Salt:      payload.Salt,
+		Seq:       payload.Seq,
+		Signature: payload.Signature,
+		Tombstone: payload.Tombstone,
+		Owner:     payload.Owner,
+		Shard:     payload.Shard,
+		Name:      payload.Name,
+		Siblings:  payload.Siblings,
+	}
+}
+
+// withRecord returns a copy of the payload carrying the value of record
+func (payload Payload) withRecord(record Record) Payload {
+	payload.Data = record.Data
+	payload.PublicKey = record.PublicKey
+	payload.Salt = record.Salt
+	payload.Seq = record.Seq
+	payload.Signature = record.Signature
+	payload.Tombstone = record.Tombstone
+	payload.Owner = record.Owner
+	payload.Shard = record.Shard
+	payload.Name = record.Name
+	payload.Siblings = record.Siblings
+	return payload
+}
+
+// hasValue reports whether the payload carries a stored value, a deletion or versioned siblings
+func (payload Payload) hasValue() bool {
+	return payload.Data != nil || payload.Tombstone || payload.Name != ""
+}
+
 // NewRPCMessage creates a new RPCMessage with a unique PacketID
 func NewRPCMessage(msgType string, payload Payload, query bool) *RPCMessage {
 	newMessage := &RPCMessage{
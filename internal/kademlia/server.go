@@ -3,6 +3,7 @@ package kademlia
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type IncomingRPC struct {
@@ -91,6 +92,15 @@ func (s *Server) listen() {
 }
 
 func (s *Server) processRequest(in IncomingRPC) {
+	// Peers from a network with another ID width are answered with an error and never added
+	if err := s.checkWidth(in.RPC); err != nil {
+		resp := *NewRPCMessage("ERROR", Payload{TargetContact: in.RPC.Payload.SourceContact, Error: err.Error()}, false)
+		resp.PacketID = in.RPC.PacketID
+		resp.Payload.SourceContact = s.node.GetSelfContact()
+		s.outgoing <- OutgoingRPC{RPC: resp, Addr: in.Addr}
+		return
+	}
+
 	var resp RPCMessage
 	switch in.RPC.Type {
 	case "PING":
@@ -98,25 +108,88 @@ func (s *Server) processRequest(in IncomingRPC) {
 			TargetContact: in.RPC.Payload.SourceContact,
 		}, false)
 	case "FIND_NODE":
-		target := NewKademliaID(in.RPC.Payload.Key)
+		target, err := ParseKademliaID(in.RPC.Payload.Key)
+		if err != nil {
+			resp = *NewRPCMessage("FIND_NODE", Payload{TargetContact: in.RPC.Payload.SourceContact, Error: err.Error()}, false)
+			break
+		}
 		contacts := s.node.LookupClosestContacts(NewContact(target, ""))
 		resp = *NewRPCMessage("FIND_NODE", Payload{
 			Contacts:      contacts,
 			TargetContact: in.RPC.Payload.SourceContact,
 		}, false)
-	case "STORE":
-		s.node.Store(in.RPC.Payload.Key, in.RPC.Payload.Data)
+	case "STORE", "DELETE":
+		// Refuse data that does not hash to its key or is not signed by the key's owner,
+		// and a DELETE that does not carry a tombstone
+		err := verifyValue(in.RPC.Payload.Key, in.RPC.Payload)
+		if err == nil && in.RPC.Type == "DELETE" && !in.RPC.Payload.Tombstone {
+			err = fmt.Errorf("DELETE without tombstone")
+		}
+		if err != nil {
+			resp = *NewRPCMessage(in.RPC.Type, Payload{
+				TargetContact: in.RPC.Payload.SourceContact,
+				Key:           in.RPC.Payload.Key,
+				Error:         err.Error(),
+			}, false)
+			break
+		}
+		record := recordFromPayload(in.RPC.Payload)
+		record.Source = in.RPC.Payload.SourceContact
+		record.Cached = in.RPC.Payload.Cache
+		if ttl := in.RPC.Payload.TTL; ttl > 0 {
+			record.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Second)
+		}
+		if err := s.node.Store(in.RPC.Payload.Key, record); err != nil {
+			resp = *NewRPCMessage(in.RPC.Type, Payload{
+				TargetContact: in.RPC.Payload.SourceContact,
+				Key:           in.RPC.Payload.Key,
+				Error:         err.Error(),
+			}, false)
+			break
+		}
 		contacts := s.node.GetSelfContact()
-		resp = *NewRPCMessage("STORE", Payload{
+		resp = *NewRPCMessage(in.RPC.Type, Payload{
 			Contacts:      []Contact{contacts},
 			TargetContact: in.RPC.Payload.SourceContact,
 			Key:           in.RPC.Payload.Key,
 		}, false)
 	case "FIND_VALUE":
-		value := s.node.LookupData(in.RPC.Payload.Key)
-		resp = *NewRPCMessage("FIND_VALUE", Payload{
-			Data:          value,
+		payload := Payload{TargetContact: in.RPC.Payload.SourceContact}
+		record, ok := s.node.LookupRecord(in.RPC.Payload.Key)
+		// The remaining lifetime goes along in whole seconds, rounded down, so a node that syncs the
+		// value never extends it. A value in its last second is no longer handed out
+		ttl := int64(time.Until(record.ExpiresAt) / time.Second)
+		if ok && (record.ExpiresAt.IsZero() || ttl > 0) {
+			payload = payload.withRecord(record)
+			if !record.ExpiresAt.IsZero() {
+				payload.TTL = ttl
+			}
+		} else if target, err := ParseKademliaID(in.RPC.Payload.Key); err != nil {
+			payload.Error = err.Error()
+		} else {
+			// Without the value, point the lookup at the closest nodes known, like FIND_NODE
+			payload.Contacts = s.node.LookupClosestContacts(NewContact(target, ""))
+		}
+		resp = *NewRPCMessage("FIND_VALUE", payload, false)
+	case "ANNOUNCE":
+		payload := Payload{TargetContact: in.RPC.Payload.SourceContact, Key: in.RPC.Payload.Key}
+		ttl := time.Duration(in.RPC.Payload.TTL) * time.Second
+		if err := s.node.AddProvider(in.RPC.Payload.Key, in.RPC.Payload.SourceContact, ttl); err != nil {
+			payload.Error = err.Error()
+		}
+		resp = *NewRPCMessage("ANNOUNCE", payload, false)
+	case "GET_PROVIDERS":
+		resp = *NewRPCMessage("GET_PROVIDERS", Payload{
 			TargetContact: in.RPC.Payload.SourceContact,
+			Key:           in.RPC.Payload.Key,
+			Contacts:      s.node.LookupProviders(in.RPC.Payload.Key),
+		}, false)
+	case "SYNC_TREE":
+		summary := s.node.MerkleSummary(in.RPC.Payload.Key)
+		resp = *NewRPCMessage("SYNC_TREE", Payload{
+			TargetContact: in.RPC.Payload.SourceContact,
+			Key:           in.RPC.Payload.Key,
+			Summary:       &summary,
 		}, false)
 	default:
 		resp = *NewRPCMessage("ERROR", Payload{TargetContact: in.RPC.Payload.SourceContact}, false)
@@ -130,10 +203,28 @@ func (s *Server) processRequest(in IncomingRPC) {
 	resp.PacketID = PID
 
 	resp.Payload.SourceContact = s.node.GetSelfContact()
+	if resp.Type == "GET_PROVIDERS" {
+		resp = fitProviders(resp)
+	}
 
 	s.outgoing <- OutgoingRPC{RPC: resp, Addr: in.Addr}
 }
 
+// checkWidth refuses requests whose sender ID or key has another width than this node's ID
+func (s *Server) checkWidth(rpc RPCMessage) error {
+	width := len(*s.node.GetSelfContact().ID)
+	if id := rpc.Payload.SourceContact.ID; id != nil && len(*id) != width {
+		return fmt.Errorf("peer ID is %d bytes, this network uses %d byte IDs", len(*id), width)
+	}
+	if rpc.Type == "SYNC_TREE" {
+		return nil
+	}
+	if id, err := ParseKademliaID(rpc.Payload.Key); err == nil && len(*id) != width {
+		return fmt.Errorf("key is %d bytes, this network uses %d byte keys", len(*id), width)
+	}
+	return nil
+}
+
 func (s *Server) respond() {
 	for {
 		select {
@@ -148,10 +239,9 @@ func (s *Server) respond() {
 	}
 }
 
-// Close gracefully shuts down the server and its network connection
+// Close gracefully shuts down the server and its network connection.
+// The request channels are left open since the listener and workers may still be sending on them
 func (s *Server) Close() error {
 	close(s.done)
-	close(s.incoming)
-	close(s.outgoing)
 	return s.network.Close()
 }
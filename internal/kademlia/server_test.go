@@ -2,6 +2,7 @@ package kademlia
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -56,7 +57,8 @@ func Test_Server_ProcessRequest_STORE(t *testing.T) {
 	assert.NoError(t, err)
 	addr := "127.0.0.1:9998"
 	registry.Register(addr)
-	rpc := NewRPCMessage("STORE", Payload{Key: "key", Data: []byte("value"), SourceContact: node.GetSelfContact()}, true)
+	key := NewKademliaIDFromData([]byte("value")).String()
+	rpc := NewRPCMessage("STORE", Payload{Key: key, Data: []byte("value"), SourceContact: node.GetSelfContact()}, true)
 	in := IncomingRPC{RPC: *rpc, Addr: addr}
 	server.incoming <- in
 	time.Sleep(500 * time.Millisecond)
@@ -68,7 +70,8 @@ func Test_Server_ProcessRequest_STORE(t *testing.T) {
 		err := json.Unmarshal(pkt.data, &outRPC)
 		assert.NoError(t, err)
 		assert.Equal(t, "STORE", outRPC.Type)
-		assert.Equal(t, "key", outRPC.Payload.Key)
+		assert.Equal(t, key, outRPC.Payload.Key)
+		assert.Empty(t, outRPC.Payload.Error)
 		assert.Equal(t, node.GetSelfContact(), outRPC.Payload.Contacts[0])
 	case <-time.After(1 * time.Second):
 		t.Error("No STORE response received")
@@ -97,11 +100,39 @@ func Test_Server_ProcessRequest_FIND_VALUE(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "FIND_VALUE", outRPC.Type)
 		assert.Nil(t, outRPC.Payload.Data)
+		// "key" is not a hex ID, so there is no closest node to point at
+		assert.Empty(t, outRPC.Payload.Contacts)
+		assert.NotEmpty(t, outRPC.Payload.Error)
 	case <-time.After(1 * time.Second):
 		t.Error("No FIND_VALUE response received")
 	}
 }
 
+func Test_Server_ProcessRequest_FIND_NODE_InvalidKey(t *testing.T) {
+	port := "4332"
+	node := &MockNodeAPI{Port: port}
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9988"
+	registry.Register(addr)
+	rpc := NewRPCMessage("FIND_NODE", Payload{Key: "not an id", SourceContact: node.GetSelfContact()}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, ok := registry.Get(addr)
+	assert.True(t, ok)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "FIND_NODE", outRPC.Type)
+		assert.Empty(t, outRPC.Payload.Contacts)
+		assert.NotEmpty(t, outRPC.Payload.Error)
+	case <-time.After(1 * time.Second):
+		t.Error("No FIND_NODE response received")
+	}
+}
+
 func Test_Server_ProcessRequest_Default_Error(t *testing.T) {
 	port := "4324"
 	node := &MockNodeAPI{Port: port}
@@ -128,3 +159,165 @@ func Test_Server_ProcessRequest_Default_Error(t *testing.T) {
 		t.Error("No ERROR response received")
 	}
 }
+
+func Test_Server_ProcessRequest_STORE_TTL(t *testing.T) {
+	port := "4325"
+	node, _ := InitNode(true, "127.0.0.1:"+port, "")
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9995"
+	registry.Register(addr)
+	source := Contact{ID: NewKademliaID("0000000000000000000000000000000000000009"), Address: addr}
+	key := NewKademliaIDFromData([]byte("value")).String()
+	rpc := NewRPCMessage("STORE", Payload{Key: key, Data: []byte("value"), TTL: 60, SourceContact: source}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, _ := registry.Get(addr)
+	select {
+	case <-ch:
+	case <-time.After(1 * time.Second):
+		t.Fatal("No STORE response received")
+	}
+	record, ok := node.Storage.Get(key)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), record.ExpiresAt, time.Second)
+}
+
+func Test_Server_ProcessRequest_STORE_Mismatch(t *testing.T) {
+	port := "4326"
+	node := &MockNodeAPI{Port: port}
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9994"
+	registry.Register(addr)
+	key := NewKademliaIDFromData([]byte("value")).String()
+	rpc := NewRPCMessage("STORE", Payload{Key: key, Data: []byte("poisoned"), SourceContact: node.GetSelfContact()}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, _ := registry.Get(addr)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "STORE", outRPC.Type)
+		assert.NotEmpty(t, outRPC.Payload.Error)
+	case <-time.After(1 * time.Second):
+		t.Error("No STORE response received")
+	}
+	assert.Nil(t, node.LookupData(key))
+}
+
+func Test_Server_ProcessRequest_SYNC_TREE(t *testing.T) {
+	port := "4328"
+	node := &MockNodeAPI{Port: port}
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9992"
+	registry.Register(addr)
+	rpc := NewRPCMessage("SYNC_TREE", Payload{Key: "ab", SourceContact: node.GetSelfContact()}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, ok := registry.Get(addr)
+	assert.True(t, ok)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "SYNC_TREE", outRPC.Type)
+		assert.Equal(t, &MerkleSummary{Prefix: "ab"}, outRPC.Payload.Summary)
+	case <-time.After(1 * time.Second):
+		t.Error("No SYNC_TREE response received")
+	}
+}
+
+func Test_Server_ProcessRequest_DELETE_WithoutTombstone(t *testing.T) {
+	port := "4329"
+	node := &MockNodeAPI{Port: port}
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9991"
+	registry.Register(addr)
+	data := []byte("value")
+	key := NewKademliaIDFromData(data).String()
+	rpc := NewRPCMessage("DELETE", Payload{Key: key, Data: data, SourceContact: node.GetSelfContact()}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, ok := registry.Get(addr)
+	assert.True(t, ok)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "DELETE", outRPC.Type)
+		assert.NotEmpty(t, outRPC.Payload.Error)
+		assert.Nil(t, node.LookupData(key))
+	case <-time.After(1 * time.Second):
+		t.Error("No DELETE response received")
+	}
+}
+
+func Test_Server_ProcessRequest_OtherIDWidth(t *testing.T) {
+	port := "4330"
+	node := &MockNodeAPI{Port: port}
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9990"
+	registry.Register(addr)
+	source := Contact{ID: SHA256KeySpace.RandomID(), Address: addr}
+	rpc := NewRPCMessage("PING", Payload{SourceContact: source}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, ok := registry.Get(addr)
+	assert.True(t, ok)
+	select {
+	case pkt := <-ch:
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "ERROR", outRPC.Type)
+		assert.Equal(t, rpc.PacketID, outRPC.PacketID)
+		assert.Contains(t, outRPC.Payload.Error, "32 bytes")
+	case <-time.After(1 * time.Second):
+		t.Error("No ERROR response received")
+	}
+}
+
+func Test_Server_ProcessRequest_GET_PROVIDERS_FitsPacket(t *testing.T) {
+	port := "4331"
+	cfg := defaultConfig()
+	WithKeySpace(SHA256KeySpace)(cfg)
+	node, _ := newNode(true, "127.0.0.1:"+port, "", cfg)
+	registry := NewMockRegistry()
+	network := NewMockNetwork("127.0.0.1:"+port, registry)
+	server, err := InitServer(node, network)
+	assert.NoError(t, err)
+	addr := "127.0.0.1:9989"
+	registry.Register(addr)
+
+	// A full set of wide providers is larger than a datagram
+	key := SHA256KeySpace.Sum([]byte("infohash")).String()
+	for i := range maxProvidersPerKey {
+		contact := Contact{ID: SHA256KeySpace.RandomID(), Address: fmt.Sprintf("100.200.100.200:%d", 10000+i)}
+		assert.NoError(t, node.AddProvider(key, contact, time.Hour))
+	}
+	source := Contact{ID: SHA256KeySpace.RandomID(), Address: addr}
+	rpc := NewRPCMessage("GET_PROVIDERS", Payload{Key: key, SourceContact: source}, true)
+	server.incoming <- IncomingRPC{RPC: *rpc, Addr: addr}
+	ch, ok := registry.Get(addr)
+	assert.True(t, ok)
+	select {
+	case pkt := <-ch:
+		assert.LessOrEqual(t, len(pkt.data), maxPacketSize)
+		var outRPC RPCMessage
+		assert.NoError(t, json.Unmarshal(pkt.data, &outRPC))
+		assert.Equal(t, "GET_PROVIDERS", outRPC.Type)
+		assert.NotEmpty(t, outRPC.Payload.Contacts)
+		assert.Less(t, len(outRPC.Payload.Contacts), maxProvidersPerKey)
+	case <-time.After(1 * time.Second):
+		t.Error("No GET_PROVIDERS response received")
+	}
+}
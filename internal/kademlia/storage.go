@@ -0,0 +1,105 @@
+package kademlia
+
+import (
+	"sync"
+	"time"
+)
+
+// Storage is the key/value backend a Node keeps its stored values in.
+// Implementations must be safe for concurrent use
+type Storage interface {
+	Put(key string, record Record) error
+	Get(key string) (Record, bool)
+	Delete(key string) error
+	// ForEach calls fn for every stored key until fn returns false
+	ForEach(fn func(key string, record Record) bool)
+	Stats() StorageStats
+}
+
+// Record is a stored value together with the bookkeeping kept for it
+type Record struct {
+	Data      []byte    `json:"data,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero means the value never expires
+	Publisher bool      `json:"publisher,omitempty"`  // this node originally published the value
+	Source    Contact   `json:"source,omitempty"`     // the contact that sent the STORE
+	Cached    bool      `json:"cached,omitempty"`     // a copy cached along a lookup path, never replicated
+	PublicKey []byte    `json:"pub,omitempty"`        // publisher key of a mutable record
+	Salt      []byte    `json:"salt,omitempty"`
+	Seq       int64     `json:"seq,omitempty"`
+	Signature []byte    `json:"sig,omitempty"`
+	Tombstone bool      `json:"tombstone,omitempty"` // the signed record was deleted by its publisher
+	Owner     []byte    `json:"owner,omitempty"`     // publisher key of an owned content addressed value
+	Name      string    `json:"name,omitempty"`      // logical name of a versioned value
+	Siblings  []Sibling `json:"siblings,omitempty"`  // concurrent values of a versioned value
+	Shard     bool      `json:"shard,omitempty"`     // an erasure shard, kept at ShardReplicas nodes instead of k
+}
+
+// Expired reports whether the record has passed its expiry time
+func (record Record) Expired(now time.Time) bool {
+	return !record.ExpiresAt.IsZero() && !now.Before(record.ExpiresAt)
+}
+
+// StorageStats summarizes the contents of a Storage
+type StorageStats struct {
+	Keys  int `json:"keys"`
+	Bytes int `json:"bytes"`
+}
+
+// MemoryStorage is the default Storage, keeping all values in a map
+type MemoryStorage struct {
+	data map[string]Record
+	mu   sync.RWMutex
+}
+
+// NewMemoryStorage returns a new, empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: make(map[string]Record)}
+}
+
+func (s *MemoryStorage) Put(key string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = record
+	return nil
+}
+
+func (s *MemoryStorage) Get(key string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.data[key]
+	return record, ok
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// ForEach iterates over a snapshot of the map so fn may call back into the storage
+func (s *MemoryStorage) ForEach(fn func(key string, record Record) bool) {
+	s.mu.RLock()
+	snapshot := make(map[string]Record, len(s.data))
+	for k, v := range s.data {
+		snapshot[k] = v
+	}
+	s.mu.RUnlock()
+
+	for k, v := range snapshot {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+func (s *MemoryStorage) Stats() StorageStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := StorageStats{Keys: len(s.data)}
+	for _, v := range s.data {
+		stats.Bytes += len(v.Data)
+	}
+	return stats
+}
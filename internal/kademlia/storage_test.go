@@ -0,0 +1,56 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemoryStorage_PutGetDelete(t *testing.T) {
+	s := NewMemoryStorage()
+	assert.NoError(t, s.Put("key", Record{Data: []byte("value")}))
+
+	record, ok := s.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), record.Data)
+
+	assert.NoError(t, s.Delete("key"))
+	_, ok = s.Get("key")
+	assert.False(t, ok)
+}
+
+func Test_MemoryStorage_ForEach(t *testing.T) {
+	s := NewMemoryStorage()
+	s.Put("a", Record{Data: []byte("1")})
+	s.Put("b", Record{Data: []byte("2")})
+
+	seen := make(map[string]string)
+	s.ForEach(func(key string, record Record) bool {
+		seen[key] = string(record.Data)
+		return true
+	})
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, seen)
+
+	count := 0
+	s.ForEach(func(key string, record Record) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+}
+
+func Test_MemoryStorage_Stats(t *testing.T) {
+	s := NewMemoryStorage()
+	s.Put("a", Record{Data: []byte("123")})
+	s.Put("b", Record{Data: []byte("45")})
+	assert.Equal(t, StorageStats{Keys: 2, Bytes: 5}, s.Stats())
+}
+
+func Test_Record_Expired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, Record{}.Expired(now))
+	assert.False(t, Record{ExpiresAt: now.Add(time.Minute)}.Expired(now))
+	assert.True(t, Record{ExpiresAt: now}.Expired(now))
+	assert.True(t, Record{ExpiresAt: now.Add(-time.Minute)}.Expired(now))
+}
@@ -0,0 +1,212 @@
+package kademlia
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Versioned values can be written by any number of writers under one logical name. Every write
+// carries a version vector counting the writes each node has made to the value. A node keeps a
+// written value only while no other value it holds has a version that descends from it, so it
+// ends up with the latest value, or with every concurrent value as siblings. Readers get all
+// siblings back together with a context, and a write made with that context replaces them all
+
+// VersionVector counts the writes made to a value per node ID
+type VersionVector map[string]uint64
+
+// Sibling is one of the concurrent values of a versioned key
+type Sibling struct {
+	Data    []byte        `json:"data"`
+	Version VersionVector `json:"version"`
+}
+
+// VersionedKey returns the key a versioned value is stored under in the default key space
+func VersionedKey(name string) *KademliaID {
+	return SHA1KeySpace.VersionedKey(name)
+}
+
+// VersionedKey returns the key a versioned value is stored under
+func (keySpace KeySpace) VersionedKey(name string) *KademliaID {
+	return keySpace.Sum([]byte("versioned:" + name))
+}
+
+// Descends reports whether v has seen every write other has, i.e. v is equal to or newer than other
+func (v VersionVector) Descends(other VersionVector) bool {
+	for id, count := range other {
+		if v[id] < count {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether v and other have seen exactly the same writes
+func (v VersionVector) Equal(other VersionVector) bool {
+	return v.Descends(other) && other.Descends(v)
+}
+
+// Concurrent reports whether neither version has seen all writes of the other
+func (v VersionVector) Concurrent(other VersionVector) bool {
+	return !v.Descends(other) && !other.Descends(v)
+}
+
+// Merge returns the version that has seen every write of both v and other
+func (v VersionVector) Merge(other VersionVector) VersionVector {
+	merged := make(VersionVector, len(v))
+	for id, count := range v {
+		merged[id] = count
+	}
+	for id, count := range other {
+		merged[id] = max(merged[id], count)
+	}
+	return merged
+}
+
+// Increment returns a copy of v with one more write made by id
+func (v VersionVector) Increment(id string) VersionVector {
+	incremented := v.Merge(nil)
+	incremented[id]++
+	return incremented
+}
+
+func (v VersionVector) String() string {
+	ids := make([]string, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s:%d", id, v[id])
+	}
+	return strings.Join(parts, ",")
+}
+
+// mergeSiblings returns the values of a and b that no other value supersedes, one per version,
+// in a stable order
+func mergeSiblings(a []Sibling, b []Sibling) []Sibling {
+	all := append(append([]Sibling{}, a...), b...)
+	var kept []Sibling
+	for i, sibling := range all {
+		superseded := false
+		for j, other := range all {
+			if i == j {
+				continue
+			}
+			if other.Version.Descends(sibling.Version) && (!sibling.Version.Descends(other.Version) || j < i) {
+				superseded = true
+				break
+			}
+		}
+		if !superseded {
+			kept = append(kept, sibling)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Version.String() < kept[j].Version.String() })
+	return kept
+}
+
+// siblingsContext returns the version that has seen every write of the given siblings
+func siblingsContext(siblings []Sibling) VersionVector {
+	context := VersionVector{}
+	for _, sibling := range siblings {
+		context = context.Merge(sibling.Version)
+	}
+	return context
+}
+
+// IsVersioned reports whether the record holds the siblings of a versioned value
+func (record Record) IsVersioned() bool {
+	return record.Name != ""
+}
+
+// verifyVersioned checks that a versioned value is stored under the key of its name
+func verifyVersioned(key string, payload Payload) error {
+	if !MatchesData(key, []byte("versioned:"+payload.Name)) {
+		return fmt.Errorf("name does not match key")
+	}
+	if len(payload.Data) > 0 || len(payload.PublicKey) > 0 || payload.Tombstone {
+		return fmt.Errorf("versioned value carries other fields")
+	}
+	if len(payload.Siblings) == 0 {
+		return fmt.Errorf("versioned value without siblings")
+	}
+	for _, sibling := range payload.Siblings {
+		if len(sibling.Version) == 0 {
+			return fmt.Errorf("sibling without version")
+		}
+	}
+	return nil
+}
+
+// PutVersioned writes data under name as a new version that supersedes every version in context,
+// which should be the context returned by the last GetVersioned. An empty context writes a value
+// concurrent to all existing ones. Returns the version of the written value
+func (client *Client) PutVersioned(name string, data []byte, context VersionVector) (VersionVector, error) {
+	key := client.config.KeySpace.VersionedKey(name).String()
+	version := context.Increment(client.node.GetSelfContact().ID.String())
+	record := Record{Name: name, Siblings: []Sibling{{Data: data, Version: version}}}
+
+	if _, err := client.SendStoreValueMessage(key, record, client.config.ValueTTL); err != nil {
+		return nil, err
+	}
+
+	keepPublished(client.node, key, record)
+	return version, nil
+}
+
+// GetVersioned reads the value written under name from every node close to its key and returns
+// all concurrent siblings, together with the context to pass to PutVersioned once they are merged
+func (client *Client) GetVersioned(name string) ([]Sibling, VersionVector, error) {
+	keyID := client.config.KeySpace.VersionedKey(name)
+	key := keyID.String()
+
+	var siblings []Sibling
+	found := false
+	if local, ok := client.node.LookupRecord(key); ok && local.IsVersioned() {
+		siblings, found = local.Siblings, true
+	}
+
+	closest, err := client.node.IterativeFindNode(keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, contact := range closest {
+		resp, err := client.SendFindValueAtMessage(key, contact)
+		if err != nil {
+			log.Printf("FIND_VALUE for %s at %s failed: %v\n", name, contact.String(), err)
+			continue
+		}
+		if resp.Payload.Name == "" {
+			continue
+		}
+		siblings, found = mergeSiblings(siblings, resp.Payload.Siblings), true
+	}
+
+	if !found {
+		return nil, nil, fmt.Errorf("versioned value not found on any contacted node")
+	}
+	return siblings, siblingsContext(siblings), nil
+}
+
+// mergeVersioned merges the siblings of an incoming versioned record with those already held,
+// callers must hold node.storeMu
+func (node *Node) mergeVersioned(key string, record Record, now time.Time) Record {
+	existing, ok := node.Storage.Get(key)
+	if !ok || existing.Expired(now) || !existing.IsVersioned() {
+		return record
+	}
+	record.Siblings = mergeSiblings(existing.Siblings, record.Siblings)
+	record.Cached = record.Cached && existing.Cached
+	if existing.Publisher {
+		record.Publisher = true
+		record.Source = existing.Source
+	}
+	if record.Publisher {
+		record.ExpiresAt = time.Time{}
+	}
+	return record
+}
@@ -0,0 +1,107 @@
+package kademlia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func versionedRecord(name string, siblings ...Sibling) Record {
+	return Record{Name: name, Siblings: siblings}
+}
+
+func Test_Version_VersionVector(t *testing.T) {
+	a := VersionVector{}.Increment("a")
+	ab := a.Increment("b")
+	b := VersionVector{}.Increment("b")
+
+	assert.True(t, ab.Descends(a))
+	assert.False(t, a.Descends(ab))
+	assert.True(t, a.Concurrent(b))
+	assert.False(t, a.Concurrent(ab))
+	assert.True(t, a.Merge(b).Equal(ab))
+	assert.Equal(t, VersionVector{"a": 1}, a, "Increment must not modify its receiver")
+	assert.Equal(t, "a:1,b:1", ab.String())
+}
+
+func Test_Version_mergeSiblings(t *testing.T) {
+	a := Sibling{Data: []byte("a"), Version: VersionVector{"a": 1}}
+	b := Sibling{Data: []byte("b"), Version: VersionVector{"b": 1}}
+	ab := Sibling{Data: []byte("ab"), Version: VersionVector{"a": 1, "b": 1}}
+
+	// Concurrent writes are both kept, in a stable order
+	assert.Equal(t, []Sibling{a, b}, mergeSiblings([]Sibling{b}, []Sibling{a}))
+	// A write that has seen both replaces them
+	assert.Equal(t, []Sibling{ab}, mergeSiblings([]Sibling{a, b}, []Sibling{ab}))
+	// An older write arriving late is dropped
+	assert.Equal(t, []Sibling{ab}, mergeSiblings([]Sibling{ab}, []Sibling{a}))
+	// The same version is kept once
+	assert.Equal(t, []Sibling{a}, mergeSiblings([]Sibling{a}, []Sibling{a}))
+}
+
+func Test_Version_verifyValue(t *testing.T) {
+	key := VersionedKey("counter").String()
+	sibling := Sibling{Data: []byte("1"), Version: VersionVector{"a": 1}}
+
+	assert.NoError(t, verifyValue(key, Payload{}.withRecord(versionedRecord("counter", sibling))))
+	assert.Error(t, verifyValue(key, Payload{}.withRecord(versionedRecord("other", sibling))))
+	assert.Error(t, verifyValue(key, Payload{}.withRecord(versionedRecord("counter"))))
+	assert.Error(t, verifyValue(key, Payload{}.withRecord(versionedRecord("counter", Sibling{Data: []byte("1")}))))
+
+	withData := Payload{}.withRecord(versionedRecord("counter", sibling))
+	withData.Data = []byte("1")
+	assert.Error(t, verifyValue(key, withData))
+}
+
+func Test_Version_Node_Store_KeepsSiblings(t *testing.T) {
+	node, _ := InitNode(true, "localhost:8000", "")
+	key := VersionedKey("counter").String()
+	a := Sibling{Data: []byte("a"), Version: VersionVector{"a": 1}}
+	b := Sibling{Data: []byte("b"), Version: VersionVector{"b": 1}}
+	ab := Sibling{Data: []byte("ab"), Version: VersionVector{"a": 1, "b": 1}}
+
+	assert.NoError(t, node.Store(key, versionedRecord("counter", a)))
+	assert.NoError(t, node.Store(key, versionedRecord("counter", b)))
+	record, ok := node.LookupRecord(key)
+	assert.True(t, ok)
+	assert.Equal(t, []Sibling{a, b}, record.Siblings)
+
+	assert.NoError(t, node.Store(key, versionedRecord("counter", ab)))
+	assert.NoError(t, node.Store(key, versionedRecord("counter", a)))
+	record, _ = node.LookupRecord(key)
+	assert.Equal(t, []Sibling{ab}, record.Siblings)
+}
+
+func Test_Version_PutGet_Concurrent(t *testing.T) {
+	nodes := newMockCluster(t, 5210, 4)
+
+	// Two writers that have not seen each other's write
+	_, err := nodes[1].Client.PutVersioned("cart", []byte("apples"), nil)
+	assert.NoError(t, err)
+	_, err = nodes[2].Client.PutVersioned("cart", []byte("pears"), nil)
+	assert.NoError(t, err)
+
+	siblings, context, err := nodes[3].Client.GetVersioned("cart")
+	assert.NoError(t, err)
+	var values []string
+	for _, sibling := range siblings {
+		values = append(values, string(sibling.Data))
+	}
+	assert.ElementsMatch(t, []string{"apples", "pears"}, values)
+
+	// Writing the merge with the returned context replaces both siblings
+	version, err := nodes[3].Client.PutVersioned("cart", []byte("apples,pears"), context)
+	assert.NoError(t, err)
+	assert.True(t, version.Descends(context))
+
+	siblings, _, err = nodes[1].Client.GetVersioned("cart")
+	assert.NoError(t, err)
+	assert.Len(t, siblings, 1)
+	assert.Equal(t, []byte("apples,pears"), siblings[0].Data)
+}
+
+func Test_Version_GetMissing(t *testing.T) {
+	nodes := newMockCluster(t, 5220, 2)
+	_, _, err := nodes[1].Client.GetVersioned("missing")
+	assert.Error(t, err)
+}